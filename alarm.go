@@ -0,0 +1,187 @@
+package archmirror
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The mirrorlist that the pacman-mirrorlist package of Arch Linux ARM installs
+const ALARMMirrorlistURL = "https://raw.githubusercontent.com/archlinuxarm/PKGBUILDs/master/core/pacman-mirrorlist/mirrorlist"
+
+// The section of the mirror that picks one close to the user
+const alarmGeoIPSection = "Worldwide"
+
+// A copy of ALARMMirrorlistURL for when it cannot be downloaded
+const alarmBundledMirrorlist = `#
+# Arch Linux ARM repository mirrorlist
+#
+
+## Geo-IP based mirror selection and load balancing
+# Server = http://mirror.archlinuxarm.org/$arch/$repo
+
+### Mirrors by country
+
+### Australia
+## Sydney
+# Server = http://au.mirror.archlinuxarm.org/$arch/$repo
+
+### Brazil
+## Sao Paulo
+# Server = http://br2.mirror.archlinuxarm.org/$arch/$repo
+
+### Denmark
+## Aalborg
+# Server = http://dk.mirror.archlinuxarm.org/$arch/$repo
+
+### Germany
+## Aachen
+# Server = http://de3.mirror.archlinuxarm.org/$arch/$repo
+## Berlin
+# Server = http://de.mirror.archlinuxarm.org/$arch/$repo
+## Coburg
+# Server = http://de4.mirror.archlinuxarm.org/$arch/$repo
+## Falkenstein
+# Server = http://de5.mirror.archlinuxarm.org/$arch/$repo
+## Nuremberg
+# Server = http://de6.mirror.archlinuxarm.org/$arch/$repo
+
+### Greece
+## Patras
+# Server = http://gr.mirror.archlinuxarm.org/$arch/$repo
+
+### Hungary
+## Budapest
+# Server = http://hu.mirror.archlinuxarm.org/$arch/$repo
+
+### Japan
+## Tokyo
+# Server = https://jp.mirror.archlinuxarm.org/$arch/$repo
+
+### Singapore
+## Singapore
+# Server = http://sg.mirror.archlinuxarm.org/$arch/$repo
+
+### Taiwan
+## Hsinchu
+# Server = http://tw.mirror.archlinuxarm.org/$arch/$repo
+## Taipei
+# Server = http://tw2.mirror.archlinuxarm.org/$arch/$repo
+
+### United States
+## California
+# Server = http://ca.us.mirror.archlinuxarm.org/$arch/$repo
+## Florida
+# Server = http://fl.us.mirror.archlinuxarm.org/$arch/$repo
+## New Jersey
+# Server = http://nj.us.mirror.archlinuxarm.org/$arch/$repo
+`
+
+// Arch Linux ARM, which has no generator. Its mirrorlist is filtered by
+// country and protocol instead, the IP versions are ignored. The mirrors
+// serve every architecture through $arch.
+type ALARMFlavor struct{}
+
+func (ALARMFlavor) Name() string {
+	return "alarm"
+}
+
+// The mirrorlist of the package, or c.BaseURL if set
+func (ALARMFlavor) Source(c *MirrorListConfig) (string, error) {
+	if c.BaseURL == "" {
+		return ALARMMirrorlistURL, nil
+	}
+	if err := CheckGeneratorURL(c.BaseURL); err != nil {
+		return "", err
+	}
+
+	return c.BaseURL, nil
+}
+
+// Download the mirrorlist of the package and select the configured mirrors.
+// If it cannot be downloaded, the bundled copy is used.
+func (f ALARMFlavor) RequestMirrorList(ctx context.Context, client *http.Client, c *MirrorListConfig) (*Mirrorlist, error) {
+	url, err := f.Source(c)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := requestList(ctx, client, c, url, plaintextList(ParseALARMMirrorlist))
+	var rateLimited *RateLimitError
+	if err != nil && (ctx.Err() != nil || errors.As(err, &rateLimited)) {
+		return nil, err
+	} else if err != nil {
+		loggerFrom(ctx).Warn("Using the bundled Arch Linux ARM mirrorlist", "error", err)
+		list, err = ParseALARMMirrorlist(strings.NewReader(alarmBundledMirrorlist))
+		if err != nil {
+			return nil, err
+		}
+		list.Generated = time.Now()
+	}
+
+	if err := c.filterList(list); err != nil {
+		return nil, err
+	}
+
+	return finishList(list, c, url)
+}
+
+// Every mirror has aarch64, which most boards run
+func (ALARMFlavor) ProbeTarget() ProbeTarget {
+	return ProbeTarget{Repo: "core", Arch: "aarch64", Small: "core.db", Large: "core.files"}
+}
+
+func (ALARMFlavor) Arches() []string {
+	return []string{"aarch64", "armv7h"}
+}
+
+func (ALARMFlavor) ServerSuffix() string {
+	return "/$arch/$repo"
+}
+
+// Parse the mirrorlist of Arch Linux ARM. Its countries are "### Country"
+// sections that contain "## City" comments, so only the Server lines and the
+// countries they are in are kept, as sections ParseMirrorlist understands.
+func ParseALARMMirrorlist(r io.Reader) (*Mirrorlist, error) {
+	var b strings.Builder
+	section := ""
+	servers := false
+	scanner := bufio.NewScanner(skipBOM(r))
+	for scanner.Scan() {
+		line := cleanLine(scanner.Text())
+		trimmed := strings.TrimSpace(line)
+		if _, _, ok := parseServerLine(line); ok {
+			if section != "" {
+				b.WriteString("## " + section + "\n")
+				section = ""
+			}
+			b.WriteString(line + "\n")
+			servers = true
+		} else if strings.HasPrefix(trimmed, "### ") {
+			// "### Mirrors by country" is followed by the first country
+			section = strings.TrimSpace(strings.TrimPrefix(trimmed, "### "))
+		} else if !servers && !strings.HasPrefix(trimmed, "## ") {
+			b.WriteString(line + "\n")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	list, err := ParseMirrorlist(strings.NewReader(b.String()))
+	if err != nil {
+		return nil, err
+	}
+	// The load balancer comes before the first country
+	for i := range list.Mirrors {
+		if list.Mirrors[i].Country == "" {
+			list.Mirrors[i].Country = alarmGeoIPSection
+		}
+	}
+
+	return list, nil
+}
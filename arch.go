@@ -0,0 +1,21 @@
+package archmirror
+
+// The architectures the $arch of a mirror URL can be replaced with
+var KnownArches = []string{"x86_64", "aarch64", "armv7h", "riscv64"}
+
+// Translate the machine of uname -m or a GOARCH into the name pacman uses
+// for $arch. Unknown names are returned as they are.
+func NormalizeArch(machine string) string {
+	switch machine {
+	case "amd64", "x86_64":
+		return "x86_64"
+	case "arm64", "aarch64", "armv8l":
+		return "aarch64"
+	case "arm", "armv7l", "armv7h":
+		return "armv7h"
+	case "riscv64":
+		return "riscv64"
+	}
+
+	return machine
+}
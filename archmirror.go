@@ -0,0 +1,517 @@
+// Package archmirror requests mirrorlists from the Arch Linux mirrorlist
+// generator and filters, ranks and writes them.
+package archmirror
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+type IPVersion uint8
+type ProtocolType uint8
+
+const (
+	// Other constants
+	ArchLinuxUrl string = "https://www.archlinux.org/mirrorlist/"
+	// The country that the generator treats as "every country"
+	CountryAll string = "all"
+
+	// IPv4 or IPv6
+	IPVersion4 IPVersion = iota
+	IPVersion6
+
+	// HTTP or HTTPS
+	ProtocolTypeHTTP ProtocolType = iota
+	ProtocolTypeHTTPS
+	// rsync is not offered by the generator, only by the mirror status
+	ProtocolTypeRsync
+	// Mirrors with any other protocol
+	ProtocolTypeUnknown
+)
+
+// The configuration of the mirrorlist
+type MirrorListConfig struct {
+	Protocols  []ProtocolType
+	IPVersions []IPVersion
+	Countries  []string
+	// Keep the Server lines that the generator comments out as they are
+	// instead of activating all mirrors
+	KeepCommented bool
+	// If set, the list is only downloaded again if it changed
+	Cache *ResponseCache
+	// The generator to ask, ArchLinuxUrl if empty
+	BaseURL string
+}
+
+// Convert the protocol to an URL parameter
+func (t *ProtocolType) ToParameter() string {
+	ret := "protocol="
+
+	switch *t {
+	case ProtocolTypeHTTP:
+		ret += "http"
+	case ProtocolTypeHTTPS:
+		ret += "https"
+	}
+
+	return ret
+}
+
+// The name of the protocol as used in URLs
+func (t ProtocolType) String() string {
+	switch t {
+	case ProtocolTypeHTTP:
+		return "http"
+	case ProtocolTypeHTTPS:
+		return "https"
+	case ProtocolTypeRsync:
+		return "rsync"
+	}
+
+	return "unknown"
+}
+
+// Parse the name of a protocol
+func ParseProtocol(name string) (ProtocolType, error) {
+	for _, t := range []ProtocolType{ProtocolTypeHTTP, ProtocolTypeHTTPS, ProtocolTypeRsync} {
+		if strings.EqualFold(name, t.String()) {
+			return t, nil
+		}
+	}
+
+	return ProtocolTypeUnknown, fmt.Errorf("unknown protocol %q", name)
+}
+
+// Whether mirrors with any of the protocols are offered by the generator
+func (c *MirrorListConfig) UsesGenerator() bool {
+	for _, p := range c.Protocols {
+		if p != ProtocolTypeRsync {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether rsync mirrors were requested
+func (c *MirrorListConfig) UsesRsync() bool {
+	for _, p := range c.Protocols {
+		if p == ProtocolTypeRsync {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The IP version as used by the generator
+func (t IPVersion) String() string {
+	switch t {
+	case IPVersion4:
+		return "4"
+	case IPVersion6:
+		return "6"
+	}
+
+	return "unknown"
+}
+
+// Convert the IP version to an URL parameter
+func (t *IPVersion) ToParameter() string {
+	ret := "ip_version="
+
+	switch *t {
+	case IPVersion4:
+		ret += "4"
+	case IPVersion6:
+		ret += "6"
+	}
+
+	return ret
+}
+
+// Check the configuration against what the generator supports
+func (c *MirrorListConfig) Validate() error {
+	for _, v := range c.Countries {
+		code, err := ResolveCountry(v)
+		if err != nil {
+			return err
+		}
+		if !IsKnownCountry(code) {
+			return fmt.Errorf("unknown country code %q", code)
+		}
+	}
+
+	return nil
+}
+
+// Tell the user which request was aborted, and why
+func requestError(ctx context.Context, action, url string, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s %s: %w", action, url, ctx.Err())
+	}
+	if err := proxyError(err); err != nil {
+		return fmt.Errorf("%s %s: %w", action, url, err)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%s %s: %w", action, url, ErrRequestTimeout)
+	}
+	// Errors of the client already name the URL, but only the last one of
+	// the redirects
+	var urlErr *neturl.Error
+	if errors.As(err, &urlErr) && errors.Is(err, ErrTooManyRedirects) {
+		return fmt.Errorf("%s %s: %w", action, url, urlErr.Err)
+	}
+	if errors.As(err, &urlErr) {
+		return err
+	}
+
+	return fmt.Errorf("%s %s: %w", action, url, err)
+}
+
+// How much of the body of a failed request is shown to the user
+const statusErrorBodyBytes = 200
+
+// Describe a response with unexpected status, including the start of the body
+func statusError(resp *http.Response) error {
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, statusErrorBodyBytes))
+	return &StatusError{
+		URL:    resp.Request.URL.String(),
+		Code:   resp.StatusCode,
+		Status: resp.Status,
+		Body:   strings.TrimSpace(string(snippet)),
+	}
+}
+
+// How much of the body is looked at to find out whether it is HTML
+const sniffBytes = 512
+
+// Whether the start of the body looks like an HTML document
+func looksLikeHTML(start []byte) bool {
+	start = bytes.ToLower(bytes.TrimSpace(bytes.TrimPrefix(start, []byte(byteOrderMark))))
+	return bytes.HasPrefix(start, []byte("<!doctype html")) || bytes.HasPrefix(start, []byte("<html"))
+}
+
+// Check that the Content-Type of the response is want, usually plaintext. Any
+// charset is fine as mirror URLs are plain ASCII. Without a Content-Type we
+// have to trust the body. An HTML page instead of a text file is an
+// ErrHTMLResponse.
+func checkContentType(header, want string) error {
+	if header == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return fmt.Errorf("invalid Content-Type %q: %w", header, err)
+	}
+	if mediaType == want {
+		return nil
+	}
+
+	switch want {
+	case "text/plain":
+		if mediaType == "text/html" {
+			return ErrHTMLResponse
+		}
+		return fmt.Errorf("%w, got %s", ErrNotPlaintext, mediaType)
+	case "application/json":
+		return fmt.Errorf("%w, got %s", ErrNotJSON, mediaType)
+	}
+
+	return fmt.Errorf("expected %s, got %s", want, mediaType)
+}
+
+// Check that url can be used instead of ArchLinuxUrl
+func CheckGeneratorURL(url string) error {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute http(s) URL", url)
+	}
+
+	return nil
+}
+
+// The URL of the generator that returns the configured mirrorlist
+func (c *MirrorListConfig) URL() (string, error) {
+	base := c.BaseURL
+	if base == "" {
+		base = ArchLinuxUrl
+	}
+	if err := CheckGeneratorURL(base); err != nil {
+		return "", err
+	}
+	u, err := neturl.Parse(base)
+	if err != nil {
+		return "", err
+	}
+
+	// Build the Parameters
+	parameters := neturl.Values{}
+	// Protocols
+	for _, v := range c.Protocols {
+		// The generator only knows about HTTP and HTTPS
+		if v == ProtocolTypeRsync {
+			continue
+		}
+		parameters.Add("protocol", v.String())
+	}
+
+	// IP versions
+	for _, v := range c.IPVersions {
+		parameters.Add("ip_version", v.String())
+	}
+
+	// Countries
+	for _, v := range c.Countries {
+		code, err := ResolveCountry(v)
+		if err != nil {
+			return "", err
+		}
+		parameters.Add("country", code)
+	}
+	u.RawQuery = parameters.Encode()
+
+	return u.String(), nil
+}
+
+// Counts the lines that are read through it
+type lineCounter struct {
+	r     io.Reader
+	lines int
+	// Whether some of the current line was read already
+	partial bool
+}
+
+func (c *lineCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.lines += bytes.Count(p[:n], []byte("\n"))
+		c.partial = p[n-1] != '\n'
+	}
+	if err == io.EOF && c.partial {
+		// The last line has no newline
+		c.lines++
+		c.partial = false
+	}
+	return n, err
+}
+
+// Request a mirrorlist from the generator using the default HTTP client
+func RequestMirrorList(c *MirrorListConfig) (*Mirrorlist, error) {
+	return RequestMirrorListWithClient(http.DefaultClient, c)
+}
+
+// Request a mirrorlist from the generator using client
+func RequestMirrorListWithClient(client *http.Client, c *MirrorListConfig) (*Mirrorlist, error) {
+	return RequestMirrorListContext(context.Background(), client, c)
+}
+
+// Request a mirrorlist from the generator using client. The request is
+// aborted once ctx is done.
+func RequestMirrorListContext(ctx context.Context, client *http.Client, c *MirrorListConfig) (*Mirrorlist, error) {
+	url, err := c.URL()
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := requestList(ctx, client, c, url, plaintextList(ParseMirrorlist))
+	if err != nil {
+		return nil, err
+	}
+
+	return finishList(list, c, url)
+}
+
+// How the response to a mirrorlist request is read
+type listFormat struct {
+	// The Content-Type the response has to have
+	mediaType string
+	parse     func(io.Reader) (*Mirrorlist, error)
+}
+
+// A list in a text file, like the one of the generator
+func plaintextList(parse func(io.Reader) (*Mirrorlist, error)) listFormat {
+	return listFormat{mediaType: "text/plain", parse: parse}
+}
+
+// Get the list at url from the cache or by downloading it
+func requestList(ctx context.Context, client *http.Client, c *MirrorListConfig, url string, format listFormat) (*Mirrorlist, error) {
+	log := loggerFrom(ctx)
+
+	var err error
+	var cached *cacheEntry
+	if c.Cache != nil {
+		cached, err = c.Cache.load(url)
+		if err != nil {
+			// A broken cache only costs us the download
+			log.Debug("Ignoring the cached mirrorlist", "error", err)
+			cached = nil
+		}
+	}
+
+	if cached != nil && time.Since(cached.Fetched) < c.Cache.TTL {
+		// Recent enough to not even ask
+		log.Debug("Using the cached mirrorlist", "fetched", cached.Fetched)
+		list, err := format.parse(strings.NewReader(cached.Body))
+		if err == nil {
+			list.Generated = cached.Fetched
+			list.FromCache = true
+			return list, nil
+		}
+		log.Debug("Ignoring the cached mirrorlist", "error", err)
+		cached = nil
+	}
+
+	return downloadMirrorlist(ctx, client, c, url, cached, format)
+}
+
+// Clean up a list that was requested from url and activate its mirrors
+func finishList(list *Mirrorlist, c *MirrorListConfig, url string) (*Mirrorlist, error) {
+	// A mirror may be listed under more than one of the requested countries
+	list.RemoveDuplicates()
+
+	// Even a worldwide list has to contain at least one mirror
+	if len(list.Mirrors) == 0 {
+		return nil, fmt.Errorf("requesting %s: %w", url, ErrEmptyMirrorlist)
+	}
+
+	// Already activate the mirrors
+	if !c.KeepCommented {
+		list.Activate()
+	}
+
+	return list, nil
+}
+
+// Send the request for the mirrorlist at url. If there is a cached copy, the
+// generator only sends the list again if it changed.
+func downloadMirrorlist(ctx context.Context, client *http.Client, c *MirrorListConfig, url string, cached *cacheEntry, format listFormat) (*Mirrorlist, error) {
+	req, err := newRequest(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	// Mirrorlists compress well
+	req.Header.Set("Accept-Encoding", "gzip")
+	log := loggerFrom(ctx)
+
+	// Only ask for the list if it changed since we last got it
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	log.Debug("Requesting the mirrorlist", "url", url)
+	resp, err := client.Do(req)
+	if err != nil {
+		err = requestError(ctx, "requesting", url, err)
+		if ctx.Err() != nil || errors.Is(err, ErrTooManyRedirects) {
+			return nil, err
+		}
+		// Connection resets and the like
+		return nil, &temporaryError{err}
+	}
+
+	defer resp.Body.Close()
+	log.Debug("Got a response", "status", resp.Status, "content_type", resp.Header.Get("Content-Type"), "content_encoding", resp.Header.Get("Content-Encoding"))
+	if resp.Request.URL.String() != url {
+		log.Debug("The mirrorlist was redirected", "url", url, "final", resp.Request.URL.String())
+	}
+	if err := decodeBody(resp); err != nil {
+		return nil, fmt.Errorf("requesting %s: %w", finalURL(url, resp), err)
+	}
+
+	notModified := resp.StatusCode == http.StatusNotModified && cached != nil
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case notModified:
+	// Only with a client that does not follow redirects
+	case resp.StatusCode >= 300 && resp.StatusCode < 400 && resp.Header.Get("Location") != "":
+		return nil, fmt.Errorf("requesting %s: %s to %s, not following it", url, resp.Status, resp.Header.Get("Location"))
+	// We are asking too often
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return nil, rateLimitError(url, resp)
+	// The generator is having a bad day
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return nil, &temporaryError{statusError(resp)}
+	default:
+		return nil, statusError(resp)
+	}
+
+	var body io.Reader
+	var raw bytes.Buffer
+	if notModified {
+		log.Debug("The mirrorlist did not change, using the cached copy", "fetched", cached.Fetched)
+		body = strings.NewReader(cached.Body)
+	} else {
+		// If we don't receive the content we expect: Bail out!
+		if err := checkContentType(resp.Header.Get("Content-Type"), format.mediaType); err != nil {
+			return nil, fmt.Errorf("requesting %s: %w", finalURL(url, resp), err)
+		}
+
+		// Some error pages claim to be plaintext
+		sniffed := bufio.NewReaderSize(resp.Body, sniffBytes)
+		if start, _ := sniffed.Peek(sniffBytes); looksLikeHTML(start) {
+			return nil, fmt.Errorf("requesting %s: %w", finalURL(url, resp), ErrHTMLResponse)
+		}
+		body = sniffed
+		if c.Cache != nil {
+			body = io.TeeReader(sniffed, &raw)
+		}
+	}
+
+	// Parse the data that is sent in the body
+	lines := &lineCounter{r: body}
+	list, err := format.parse(lines)
+	if err != nil && notModified {
+		// Our copy is broken, not the generator
+		log.Debug("Ignoring the cached mirrorlist", "error", err)
+		return downloadMirrorlist(ctx, client, c, url, nil, format)
+	}
+	if err != nil {
+		err = requestError(ctx, "reading the mirrorlist from", url, err)
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		// The connection broke off halfway through
+		return nil, &temporaryError{err}
+	}
+	list.Generated = time.Now()
+	list.FromCache = notModified
+	log.Log(ctx, LevelTrace, "Read the mirrorlist", "lines", lines.lines, "mirrors", len(list.Mirrors))
+
+	// Remember the list for the next time
+	if c.Cache != nil {
+		entry := cached
+		if !notModified {
+			entry = &cacheEntry{
+				URL:          url,
+				ETag:         resp.Header.Get("ETag"),
+				LastModified: resp.Header.Get("Last-Modified"),
+				Body:         raw.String(),
+			}
+		}
+		entry.Fetched = list.Generated
+		if err := c.Cache.store(entry); err != nil {
+			log.Warn("Failed saving the mirrorlist cache", "error", err)
+		}
+	}
+
+	return list, nil
+}
@@ -0,0 +1,281 @@
+package archmirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// What the generator sends for a single country
+const testMirrorlist = `##
+## Arch Linux repository mirrorlist
+## Generated on 2026-10-14
+##
+
+## Germany
+#Server = https://a.example/$repo/os/$arch
+#Server = https://b.example/archlinux/$repo/os/$arch
+`
+
+// A generator that answers every request with status, Content-Type and body
+func testGenerator(t *testing.T, status int, contentType, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// The configuration asking srv for the German HTTPS mirrors
+func testConfig(srv *httptest.Server) *MirrorListConfig {
+	return &MirrorListConfig{
+		Protocols:  []ProtocolType{ProtocolTypeHTTPS},
+		IPVersions: []IPVersion{IPVersion4},
+		Countries:  []string{"DE"},
+		BaseURL:    srv.URL + "/mirrorlist/",
+	}
+}
+
+func TestRequestMirrorListContext(t *testing.T) {
+	srv := testGenerator(t, http.StatusOK, "text/plain; charset=utf-8", testMirrorlist)
+
+	list, err := RequestMirrorListContext(context.Background(), srv.Client(), testConfig(srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://a.example/$repo/os/$arch", "https://b.example/archlinux/$repo/os/$arch"}
+	if len(list.Mirrors) != len(want) {
+		t.Fatalf("got %d mirrors, want %d", len(list.Mirrors), len(want))
+	}
+	for i, m := range list.Mirrors {
+		if m.URL != want[i] {
+			t.Errorf("mirror %d is %q, want %q", i, m.URL, want[i])
+		}
+		if !m.Active {
+			t.Errorf("mirror %d was not activated", i)
+		}
+		if m.Country != "Germany" {
+			t.Errorf("mirror %d is in %q, want Germany", i, m.Country)
+		}
+		if m.Protocol != ProtocolTypeHTTPS {
+			t.Errorf("mirror %d has protocol %s, want https", i, m.Protocol)
+		}
+	}
+	if list.Generated.IsZero() {
+		t.Error("the list has no generation time")
+	}
+}
+
+func TestRequestMirrorListKeepCommented(t *testing.T) {
+	srv := testGenerator(t, http.StatusOK, "text/plain", testMirrorlist)
+	c := testConfig(srv)
+	c.KeepCommented = true
+
+	list, err := RequestMirrorListContext(context.Background(), srv.Client(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range list.Mirrors {
+		if m.Active || !m.Commented {
+			t.Errorf("mirror %d should have stayed commented out", i)
+		}
+	}
+}
+
+func TestRequestMirrorListEmpty(t *testing.T) {
+	srv := testGenerator(t, http.StatusOK, "text/plain", "##\n## Arch Linux repository mirrorlist\n##\n")
+
+	_, err := RequestMirrorListContext(context.Background(), srv.Client(), testConfig(srv))
+	if err == nil {
+		t.Fatal("a list without mirrors was accepted")
+	}
+}
+
+// Counts the requests that go through it
+type countingTransport struct {
+	next     http.RoundTripper
+	requests atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return t.next.RoundTrip(req)
+}
+
+func TestRequestMirrorListWithClient(t *testing.T) {
+	srv := testGenerator(t, http.StatusOK, "text/plain", testMirrorlist)
+	transport := &countingTransport{next: srv.Client().Transport}
+
+	list, err := RequestMirrorListWithClient(&http.Client{Transport: transport}, testConfig(srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Mirrors) != 2 {
+		t.Errorf("got %d mirrors, want 2", len(list.Mirrors))
+	}
+	if n := transport.requests.Load(); n != 1 {
+		t.Errorf("the client made %d requests, want 1", n)
+	}
+}
+
+func TestRequestMirrorListNotPlaintext(t *testing.T) {
+	for _, contentType := range []string{"application/json", "application/octet-stream", "text/csv"} {
+		srv := testGenerator(t, http.StatusOK, contentType, testMirrorlist)
+
+		_, err := RequestMirrorListWithClient(srv.Client(), testConfig(srv))
+		if !errors.Is(err, ErrNotPlaintext) {
+			t.Errorf("got %v for %s, want %v", err, contentType, ErrNotPlaintext)
+		}
+	}
+}
+
+func TestCheckContentType(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		want   error
+	}{
+		{"text/plain", nil},
+		{"text/plain; charset=utf-8", nil},
+		{"Text/Plain; Charset=UTF-8", nil},
+		{"text/html", ErrHTMLResponse},
+		{"text/html; charset=utf-8", ErrHTMLResponse},
+		// Nothing to go by but the body
+		{"", nil},
+		{"application/json", ErrNotPlaintext},
+	} {
+		err := checkContentType(tc.header, "text/plain")
+		if (tc.want == nil && err != nil) || !errors.Is(err, tc.want) {
+			t.Errorf("checkContentType(%q) = %v, want %v", tc.header, err, tc.want)
+		}
+	}
+
+	if err := checkContentType("text/plain; charset", "text/plain"); err == nil {
+		t.Error("an invalid Content-Type was accepted")
+	}
+}
+
+func TestRequestMirrorListContentType(t *testing.T) {
+	for _, tc := range []struct {
+		contentType string
+		want        error
+	}{
+		{"text/plain", nil},
+		{"text/plain; charset=utf-8", nil},
+		{"text/html", ErrHTMLResponse},
+		{"", nil},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Otherwise net/http sniffs a Content-Type for us
+			w.Header()["Content-Type"] = nil
+			if tc.contentType != "" {
+				w.Header().Set("Content-Type", tc.contentType)
+			}
+			w.Write([]byte(testMirrorlist))
+		}))
+
+		list, err := RequestMirrorListWithClient(srv.Client(), testConfig(srv))
+		srv.Close()
+		if tc.want == nil && err != nil {
+			t.Errorf("Content-Type %q: %v", tc.contentType, err)
+		} else if tc.want == nil && len(list.Mirrors) != 2 {
+			t.Errorf("Content-Type %q: got %d mirrors, want 2", tc.contentType, len(list.Mirrors))
+		} else if !errors.Is(err, tc.want) {
+			t.Errorf("Content-Type %q: got %v, want %v", tc.contentType, err, tc.want)
+		}
+	}
+}
+
+func TestRequestMirrorListCutOff(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		// Promise the whole list, but only send the first half
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n")
+		fmt.Fprintf(buf, "Content-Length: %d\r\n\r\n", len(testMirrorlist))
+		buf.WriteString(testMirrorlist[:len(testMirrorlist)/2])
+		buf.Flush()
+	}))
+	t.Cleanup(srv.Close)
+
+	list, err := RequestMirrorListWithClient(srv.Client(), testConfig(srv))
+	if err == nil {
+		t.Fatalf("got a list with %d mirrors from a connection that broke off", len(list.Mirrors))
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if !IsTemporary(err) {
+		t.Errorf("%v should be retried", err)
+	}
+}
+
+func TestRequestMirrorListWithoutFinalNewline(t *testing.T) {
+	srv := testGenerator(t, http.StatusOK, "text/plain", strings.TrimSuffix(testMirrorlist, "\n"))
+
+	list, err := RequestMirrorListWithClient(srv.Client(), testConfig(srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(list.Mirrors); n != 2 || list.Mirrors[1].URL != "https://b.example/archlinux/$repo/os/$arch" {
+		t.Errorf("got %v, want the last line to be a mirror too", list.Mirrors)
+	}
+}
+
+func TestMirrorListConfigURL(t *testing.T) {
+	for _, tc := range []struct {
+		c    MirrorListConfig
+		want string
+	}{
+		{
+			MirrorListConfig{Protocols: []ProtocolType{ProtocolTypeHTTPS}, IPVersions: []IPVersion{IPVersion4}, Countries: []string{"DE"}},
+			ArchLinuxUrl + "?country=DE&ip_version=4&protocol=https",
+		},
+		{
+			MirrorListConfig{Protocols: []ProtocolType{ProtocolTypeHTTP, ProtocolTypeHTTPS, ProtocolTypeRsync}, IPVersions: []IPVersion{IPVersion4, IPVersion6}, Countries: []string{"Germany", "fr"}},
+			ArchLinuxUrl + "?country=DE&country=FR&ip_version=4&ip_version=6&protocol=http&protocol=https",
+		},
+		{
+			MirrorListConfig{Protocols: []ProtocolType{ProtocolTypeHTTPS}, Countries: []string{CountryAll}, BaseURL: "http://localhost:8080/mirrorlist/"},
+			"http://localhost:8080/mirrorlist/?country=all&protocol=https",
+		},
+		// Codes we do not know are passed on as they are, but escaped
+		{
+			MirrorListConfig{Protocols: []ProtocolType{ProtocolTypeHTTPS}, Countries: []string{"&x", "a+"}},
+			ArchLinuxUrl + "?country=%26X&country=A%2B&protocol=https",
+		},
+	} {
+		got, err := tc.c.URL()
+		if err != nil {
+			t.Errorf("%v: %v", tc.c, err)
+		} else if got != tc.want {
+			t.Errorf("got %s, want %s", got, tc.want)
+		}
+	}
+}
+
+func TestMirrorListConfigURLInvalid(t *testing.T) {
+	for _, c := range []MirrorListConfig{
+		{Countries: []string{"Atlantis"}},
+		{BaseURL: "ftp://example.org/mirrorlist/"},
+		{BaseURL: "/mirrorlist/"},
+	} {
+		if got, err := c.URL(); err == nil {
+			t.Errorf("got %s for %v, want an error", got, c)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package archmirror
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// The timestamp that is appended to the name of a backup
+const backupTimeFormat = "2006-01-02T15:04:05"
+
+// The path of the backup of path that is made at the given time
+func BackupPath(path string, t time.Time) string {
+	return path + "." + t.Format(backupTimeFormat)
+}
+
+// Copy the file at path to a timestamped backup next to it, keeping its
+// permissions and ownership. Returns the path of the backup or an empty
+// string if there was nothing to back up.
+func BackupFile(path string, t time.Time) (string, error) {
+	src, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	backup := BackupPath(path, t)
+	dst, err := os.OpenFile(backup, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return "", err
+	}
+
+	// Don't leave a broken backup behind
+	fail := func(err error) (string, error) {
+		dst.Close()
+		os.Remove(backup)
+		return "", err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		return fail(err)
+	}
+	// The umask may have removed some of the permission bits
+	if err := dst.Chmod(info.Mode().Perm()); err != nil {
+		return fail(err)
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		if int(st.Uid) != os.Getuid() || int(st.Gid) != os.Getgid() {
+			if err := dst.Chown(int(st.Uid), int(st.Gid)); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	if err := dst.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(backup)
+		return "", err
+	}
+
+	return backup, nil
+}
+
+// A backup that was made by BackupFile
+type backupFile struct {
+	path string
+	time time.Time
+}
+
+// Find the backups that BackupFile made of path, newest first
+func listBackups(path string) ([]backupFile, error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]backupFile, 0)
+	for _, e := range entries {
+		suffix, ok := strings.CutPrefix(e.Name(), base+".")
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		// Only touch files whose name is exactly what we would have created
+		t, err := time.Parse(backupTimeFormat, suffix)
+		if err != nil || t.Format(backupTimeFormat) != suffix {
+			continue
+		}
+		backups = append(backups, backupFile{filepath.Join(dir, e.Name()), t})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].time.After(backups[j].time)
+	})
+
+	return backups, nil
+}
+
+// Remove all but the newest keep backups of path. Returns the paths of the
+// removed backups.
+func PruneBackups(path string, keep int) ([]string, error) {
+	backups, err := listBackups(path)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := make([]string, 0)
+	for i := keep; i < len(backups); i++ {
+		if err := os.Remove(backups[i].path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, backups[i].path)
+	}
+
+	return removed, nil
+}
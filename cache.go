@@ -0,0 +1,91 @@
+package archmirror
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Keeps the last mirrorlist the generator sent for each set of parameters, so
+// that it does not have to be downloaded again when nothing changed
+type ResponseCache struct {
+	dir string
+	// Responses younger than this are used without asking the generator at
+	// all, 0 always asks
+	TTL time.Duration
+}
+
+// A cached response
+type cacheEntry struct {
+	URL string `json:"url"`
+	// The validators to send along with the next request
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	// When the generator last confirmed the body
+	Fetched time.Time `json:"fetched"`
+	Body    string    `json:"body"`
+}
+
+// The default location of the response cache, honoring $XDG_CACHE_HOME
+func DefaultResponseCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "archmirror", "mirrorlists"), nil
+}
+
+// Create a response cache that keeps its files in dir and uses responses
+// younger than ttl without asking
+func NewResponseCache(dir string, ttl time.Duration) *ResponseCache {
+	return &ResponseCache{dir: dir, TTL: ttl}
+}
+
+// The file of the response to url. The URL contains every parameter of the
+// request, so a different country ends up in a different file.
+func (c *ResponseCache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// Read the cached response to url. Returns nil without an error if there is
+// none.
+func (c *ResponseCache) load(url string) (*cacheEntry, error) {
+	data, err := os.ReadFile(c.path(url))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, err
+	}
+	// Two URLs with the same hash are very unlikely, but cheap to rule out
+	if entry.URL != url {
+		return nil, nil
+	}
+
+	return entry, nil
+}
+
+// Atomically write the response to the cache
+func (c *ResponseCache) store(entry *cacheEntry) error {
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(c.path(entry.URL), data, true)
+}
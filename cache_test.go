@@ -0,0 +1,119 @@
+package archmirror
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A generator that answers If-None-Match "v1" with 304 Not Modified and
+// counts the full responses
+func cachingGenerator(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var full atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(testMirrorlist))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &full
+}
+
+func TestRequestMirrorListNotModified(t *testing.T) {
+	srv, full := cachingGenerator(t)
+	c := testConfig(srv)
+	c.Cache = NewResponseCache(t.TempDir(), 0)
+
+	first, err := RequestMirrorListContext(context.Background(), srv.Client(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.FromCache {
+		t.Error("the first list claims to come from the cache")
+	}
+
+	second, err := RequestMirrorListContext(context.Background(), srv.Client(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.FromCache {
+		t.Error("the list that did not change was not taken from the cache")
+	}
+	if !reflect.DeepEqual(second.Mirrors, first.Mirrors) {
+		t.Errorf("got %v from the cache, want %v", second.Mirrors, first.Mirrors)
+	}
+	if n := full.Load(); n != 1 {
+		t.Errorf("downloaded the mirrorlist %d times, want 1", n)
+	}
+}
+
+// A status API that answers If-None-Match "v1" with 304 Not Modified and
+// counts the full responses
+func manjaroGenerator(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var full atomic.Int32
+	status := readFixture(t, "manjaro-status.json")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(status))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &full
+}
+
+func TestCorruptCacheIsDownloadedAgain(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ttl  time.Duration
+	}{
+		{"recent enough", time.Hour},
+		{"not modified", 0},
+	} {
+		srv, full := manjaroGenerator(t)
+		c := &MirrorListConfig{
+			Protocols: []ProtocolType{ProtocolTypeHTTP},
+			Countries: []string{"DE"},
+			BaseURL:   srv.URL + "/status.json",
+			Cache:     NewResponseCache(t.TempDir(), tc.ttl),
+		}
+		// Valid JSON, but not a status
+		if err := c.Cache.store(&cacheEntry{URL: c.BaseURL, ETag: `"v1"`, Fetched: time.Now(), Body: "not a status"}); err != nil {
+			t.Fatal(err)
+		}
+
+		l, err := ManjaroFlavor{Branch: "testing"}.RequestMirrorList(context.Background(), srv.Client(), c)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		want := []string{"http://manjaro.a.example/testing/$repo/$arch", "http://manjaro.c.example/testing/$repo/$arch"}
+		if got := activeURLs(l); !slices.Equal(got, want) || l.FromCache {
+			t.Errorf("%s: got %q, want %q from the generator", tc.name, got, want)
+		}
+		if n := full.Load(); n != 1 {
+			t.Errorf("%s: downloaded the status %d times, want 1", tc.name, n)
+		}
+
+		// The broken entry was replaced
+		entry, err := c.Cache.load(c.BaseURL)
+		if err != nil || entry == nil || entry.Body != readFixture(t, "manjaro-status.json") {
+			t.Errorf("%s: the cache was not replaced: %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"runtime"
+	"syscall"
+)
+
+// The machine we run on as uname -m tells it
+func hostMachine() string {
+	var u syscall.Utsname
+	if err := syscall.Uname(&u); err != nil {
+		return runtime.GOARCH
+	}
+	// int8 or uint8 depending on the architecture
+	machine := make([]byte, 0, len(u.Machine))
+	for _, c := range u.Machine {
+		if c == 0 {
+			break
+		}
+		machine = append(machine, byte(c))
+	}
+
+	return string(machine)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "runtime"
+
+// Without uname the architecture of the binary has to do
+func hostMachine() string {
+	return runtime.GOARCH
+}
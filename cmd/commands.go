@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/PapaTutuWawa/archmirror"
+	"github.com/PapaTutuWawa/archmirror/internal/style"
+	"github.com/PapaTutuWawa/archmirror/internal/version"
+)
+
+// A subcommand of archmirror
+type command struct {
+	summary string
+	run     func(args []string) error
+	// The flags the command understands, nil if there are none
+	flags func() *flag.FlagSet
+}
+
+var commands map[string]command
+
+func init() {
+	// Invalid flags are turned into an exit code like every other error
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	commands = map[string]command{
+		"fetch":         {"Fetch, filter, rank and write a mirrorlist (the default)", fetch, fetchFlags},
+		"countries":     {"List the countries the generator offers", countriesCommand, countriesFlags},
+		"status":        {"Show what archlinux.org knows about the mirrors", statusCommand, statusFlags},
+		"install-units": {"Print or install a systemd service and timer running fetch", installUnitsCommand, installUnitsFlags},
+		"rank":          {"Rank the mirrors of an existing mirrorlist, fetch -in " + defaultInput + " -rank latency", rankCommand, fetchFlags},
+		"validate":      {"Check that the active Server lines of a mirrorlist are usable by pacman", validateCommand, validateFlags},
+		"version":       {"Show which build of archmirror this is, like -version", versionCommand, nil},
+		"completion":    {"Print a completion script for bash, zsh or fish", completionCommand, nil},
+	}
+	flag.Usage = func() {
+		printCommands(flag.CommandLine.Output())
+		fmt.Fprintf(flag.CommandLine.Output(), "\nFlags of fetch:\n")
+		flag.PrintDefaults()
+	}
+}
+
+// Print the available subcommands
+func printCommands(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].summary)
+	}
+}
+
+// The flags of fetch that every subcommand that talks to archlinux.org
+// understands
+var connectionFlags = []string{
+	"v", "verbose", "vv", "q", "quiet", "log-format", "color", "config",
+	"proxy", "ca-file", "insecure", "no-follow-redirects", "user-agent", "timeout", "deadline", "url",
+}
+
+// Create the flags of a subcommand. The connection flags share their values
+// with the ones of fetch.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	for _, n := range connectionFlags {
+		f := flag.CommandLine.Lookup(n)
+		fs.Var(f.Value, f.Name, f.Usage)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [flags]\n\n%s\n\nFlags:\n", os.Args[0], name, commands[name].summary)
+		fs.PrintDefaults()
+	}
+
+	return fs
+}
+
+// What every command needs to talk to archlinux.org
+type session struct {
+	// Cancelled on SIGINT, SIGTERM or when the deadline passed
+	ctx context.Context
+	// For requests to archlinux.org
+	client *http.Client
+	// For probing the mirrors
+	probeClient *http.Client
+}
+
+// Read the configuration and set up logging and the HTTP clients for the
+// command whose flags were parsed into fs. The returned function has to be
+// called once done.
+func setup(fs *flag.FlagSet) (*session, func(), error) {
+	cleanups := make([]func(), 0)
+	cleanup := func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}
+
+	// The command line wins over the environment, which wins over the
+	// configuration files
+	configWarnings, err := applyConfig(fs)
+	if err != nil {
+		return nil, nil, usageError("Failed reading the configuration: %w", err)
+	}
+	if *printConfigs {
+		printConfig(os.Stdout)
+		return nil, nil, errDone
+	}
+
+	// -vv includes everything -v prints
+	*verbose = *verbose || *debug
+	if *quiet && *verbose {
+		return nil, nil, usageError("-quiet and -verbose cannot be used together!")
+	}
+	level := slog.LevelInfo
+	switch {
+	case *quiet:
+		level = slog.LevelError
+	case *debug:
+		level = archmirror.LevelTrace
+	case *verbose:
+		level = slog.LevelDebug
+	}
+	color, err := style.Enabled(*colorMode, isTerminal(os.Stderr))
+	if err != nil {
+		return nil, nil, usageError("Invalid -color: %w", err)
+	}
+	colors = style.New(color)
+	logger, err := newLogger(stderr, *logFormat, level, colors)
+	if err != nil {
+		return nil, nil, usageError("Invalid log format: %w", err)
+	}
+	slog.SetDefault(logger)
+	for _, w := range configWarnings {
+		slog.Warn(w)
+	}
+
+	if *userAgent != "" {
+		archmirror.UserAgent = *userAgent
+	}
+	if err := archmirror.CheckGeneratorURL(*generatorURL); err != nil {
+		return nil, nil, usageError("Invalid -url: %w", err)
+	}
+	slog.Debug("Using the mirrorlist generator", "url", *generatorURL)
+
+	// Everything is aborted on SIGINT, SIGTERM or when the deadline passed
+	ctx, stop := interruptContext(archmirror.WithLogger(context.Background(), logger))
+	cleanups = append(cleanups, stop)
+	// In daemon mode the deadline applies to each refresh instead
+	if *deadline > 0 && !*daemon {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *deadline)
+		cleanups = append(cleanups, cancel)
+	}
+
+	// Requests to archlinux.org are bounded by -timeout, probes by -probe-timeout
+	transport, err := newTransport()
+	if err != nil {
+		cleanup()
+		return nil, nil, usageError("Failed setting up the connection: %w", err)
+	}
+	logProxy(transport)
+
+	// Every worker keeps the connection to the mirror it probes, so that
+	// -warmup and -samples measure requests over an open connection. They
+	// are closed once the ranking is done.
+	probeTransport := transport.Clone()
+	probeTransport.MaxIdleConns = 0
+	probeTransport.MaxIdleConnsPerHost = max(*probeThreads, http.DefaultMaxIdleConnsPerHost)
+	// A proxy would connect to the mirrors in our place, over whatever it
+	// likes
+	if *requireIPv4 && *requireIPv6 {
+		cleanup()
+		return nil, nil, usageError("Use either -require-ipv4-reachable or -require-ipv6-reachable!")
+	}
+	if v, ok := probeIPVersion(); ok {
+		if *proxy != "" {
+			cleanup()
+			return nil, nil, usageError("-require-ipv%s-reachable cannot be checked through -proxy!", v)
+		}
+		probeTransport.Proxy = nil
+		probeTransport.DialContext = archmirror.DialIPVersion(v, nil)
+		slog.Debug("Probing the mirrors directly over IPv" + v.String())
+	}
+
+	// Redirects are followed a few times, the mirrors may redirect as they like
+	maxRedirects := archmirror.MaxRedirects
+	if *noRedirects {
+		maxRedirects = 0
+	}
+
+	return &session{
+		ctx:         ctx,
+		client:      &http.Client{Transport: transport, Timeout: *timeout, CheckRedirect: archmirror.RedirectPolicy(maxRedirects)},
+		probeClient: &http.Client{Transport: probeTransport},
+	}, cleanup, nil
+}
+
+// archmirror countries
+// The flags of fetch are the global ones
+func fetchFlags() *flag.FlagSet {
+	return flag.CommandLine
+}
+
+var countriesJSON bool
+
+func countriesFlags() *flag.FlagSet {
+	fs := newFlagSet("countries")
+	fs.BoolVar(&countriesJSON, "json", false, "Print the countries as JSON")
+	return fs
+}
+
+func countriesCommand(args []string) error {
+	fs := countriesFlags()
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	s, cleanup, err := setup(fs)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if err := printCountries(s.ctx, s.client, countriesJSON); err != nil {
+		return networkError("Failed requesting the country list: %w", err)
+	}
+
+	return nil
+}
+
+// archmirror version
+func versionCommand(args []string) error {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s version\n\n%s\n", os.Args[0], commands["version"].summary)
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	fmt.Println(version.String())
+
+	return nil
+}
+
+// The mirrorlist that rank sorts by default
+const defaultInput = "/etc/pacman.d/mirrorlist"
+
+// Change the default of a flag of fetch. Unlike flag.Set, the flag does not
+// count as given on the command line, so the configuration still applies.
+func setDefault(name, value string) {
+	f := flag.CommandLine.Lookup(name)
+	f.Value.Set(value)
+	f.DefValue = value
+}
+
+// archmirror rank is fetch with different defaults. Everything can still be
+// changed by the flags and the configuration.
+func rankCommand(args []string) error {
+	setDefault("in", defaultInput)
+	setDefault("rank", string(archmirror.RankLatency))
+
+	return fetch(args)
+}
+
+var statusCountries stringList
+
+func statusFlags() *flag.FlagSet {
+	fs := newFlagSet("status")
+	fs.Var(&statusCountries, "country", "Only show mirrors in this country, as code or name (may be repeated or comma-separated)")
+	return fs
+}
+
+// archmirror status
+func statusCommand(args []string) error {
+	fs := statusFlags()
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	s, cleanup, err := setup(fs)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	codes := make(map[string]bool)
+	for _, c := range statusCountries {
+		code, err := archmirror.ResolveCountry(c)
+		if err != nil {
+			return usageError("Invalid country: %w", err)
+		}
+		codes[code] = true
+	}
+
+	report, err := archmirror.RequestMirrorStatusContext(s.ctx, s.client)
+	if err != nil {
+		return networkError("Failed requesting the mirror status: %w", err)
+	}
+
+	mirrors := make([]archmirror.MirrorStatus, 0, len(report.URLs))
+	for _, m := range report.URLs {
+		if len(codes) == 0 || codes[m.CountryCode] {
+			mirrors = append(mirrors, m)
+		}
+	}
+	// The best mirrors first, the ones without a score last
+	sort.SliceStable(mirrors, func(i, j int) bool {
+		a, b := mirrors[i].Score, mirrors[j].Score
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return *a < *b
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MIRROR\tCOUNTRY\tSCORE\tCOMPLETION\tDELAY\tLAST SYNC")
+	for _, m := range mirrors {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", m.URL, m.CountryCode, statusScore(m.Score), fmt.Sprintf("%.1f%%", m.CompletionPct*100), statusDelay(m.Delay), statusTime(m.LastSync))
+	}
+	w.Flush()
+	fmt.Fprintf(os.Stdout, "%d mirrors, last checked %s\n", len(mirrors), report.LastCheck.Format(time.RFC3339))
+
+	return nil
+}
+
+// Format the optional fields of the mirror status
+func statusScore(score *float64) string {
+	if score == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", *score)
+}
+
+func statusDelay(seconds *int64) string {
+	if seconds == nil {
+		return "-"
+	}
+	return (time.Duration(*seconds) * time.Second).String()
+}
+
+func statusTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// Run the subcommand named by the first argument, fetch if there is none
+func run(args []string) error {
+	name := "fetch"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		flag.Usage()
+		return nil
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		printCommands(os.Stderr)
+		return &exitError{exitUsage, errReported}
+	}
+
+	return cmd.run(args)
+}
+
+// Parse the flags of a command. The flag package reports invalid flags
+// itself.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return errDone
+	} else if err != nil {
+		return &exitError{exitUsage, errReported}
+	}
+
+	return nil
+}
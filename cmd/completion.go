@@ -0,0 +1,220 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/PapaTutuWawa/archmirror"
+	"github.com/PapaTutuWawa/archmirror/internal/style"
+)
+
+// The values offered for the flags that only take a few, everything else
+// completes file names
+var flagValues = map[string]func() []string{
+	"country": func() []string {
+		codes := []string{archmirror.CountryAll}
+		for _, c := range archmirror.Countries {
+			codes = append(codes, c.Code)
+		}
+		return codes
+	},
+	"protocol":       func() []string { return []string{"http", "https", "rsync"} },
+	"rank":           func() []string { return []string{string(archmirror.RankLatency), string(archmirror.RankRate)} },
+	"sort":           func() []string { return sortKeyNames() },
+	"output-format":  archmirror.OutputFormatNames,
+	"log-format":     func() []string { return logFormats },
+	"color":          func() []string { return style.Modes },
+	"summary-format": func() []string { return summaryFormats },
+	"flavor":         archmirror.FlavorNames,
+	"branch":         func() []string { return archmirror.ManjaroBranches },
+	"arch":           func() []string { return archmirror.KnownArches },
+}
+
+// The shells completion can write a script for
+var completionShells = map[string]func(io.Writer){
+	"bash": writeBashCompletion,
+	"zsh":  writeZshCompletion,
+	"fish": writeFishCompletion,
+}
+
+// A flag as the completion scripts see it
+type completionFlag struct {
+	name, usage string
+	// Takes no value
+	boolean bool
+	// May be given more than once
+	repeated bool
+	// The values to offer, nil for file names
+	values []string
+}
+
+// The subcommands in a stable order
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// The flags of the command name, taken from the flag set it really parses
+func completionFlags(name string) []completionFlag {
+	if commands[name].flags == nil {
+		return nil
+	}
+
+	flags := make([]completionFlag, 0)
+	commands[name].flags().VisitAll(func(f *flag.Flag) {
+		c := completionFlag{name: f.Name, usage: f.Usage}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			c.boolean = true
+		}
+		switch f.Value.(type) {
+		case *stringList, *regexpList:
+			c.repeated = true
+		}
+		if values, ok := flagValues[f.Name]; ok {
+			c.values = values()
+		}
+		flags = append(flags, c)
+	})
+
+	return flags
+}
+
+// archmirror completion
+func completionCommand(args []string) error {
+	fs := flag.NewFlagSet("completion", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s completion bash|zsh|fish\n\n%s\n", os.Args[0], commands["completion"].summary)
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageError("Name the shell to complete: bash, zsh or fish")
+	}
+	write, ok := completionShells[fs.Arg(0)]
+	if !ok {
+		return usageError("Unknown shell %q, use bash, zsh or fish", fs.Arg(0))
+	}
+	write(os.Stdout)
+
+	return nil
+}
+
+func writeBashCompletion(w io.Writer) {
+	names := commandNames()
+	fmt.Fprintf(w, "# bash completion for archmirror, generated by archmirror completion bash\n\n")
+	fmt.Fprintf(w, "_archmirror() {\n")
+	fmt.Fprintf(w, "\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\" cmd=fetch\n")
+	fmt.Fprintf(w, "\tcase \"${COMP_WORDS[1]}\" in\n\t%s) cmd=\"${COMP_WORDS[1]}\" ;;\n\tesac\n\n", strings.Join(names, "|"))
+
+	// The values depend on the flag, not on the command
+	fmt.Fprintf(w, "\tcase \"$prev\" in\n")
+	flagNames := make([]string, 0, len(flagValues))
+	for name := range flagValues {
+		flagNames = append(flagNames, name)
+	}
+	sort.Strings(flagNames)
+	for _, name := range flagNames {
+		fmt.Fprintf(w, "\t-%s)\n\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n\t\treturn\n\t\t;;\n", name, strings.Join(flagValues[name](), " "))
+	}
+	fmt.Fprintf(w, "\tesac\n\n")
+
+	fmt.Fprintf(w, "\tif [[ $cur == -* ]]; then\n\t\tcase \"$cmd\" in\n")
+	for _, name := range names {
+		flags := completionFlags(name)
+		if len(flags) == 0 {
+			continue
+		}
+		words := make([]string, 0, len(flags))
+		for _, f := range flags {
+			words = append(words, "-"+f.name)
+		}
+		fmt.Fprintf(w, "\t\t%s) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", name, strings.Join(words, " "))
+	}
+	fmt.Fprintf(w, "\t\tesac\n\telif [[ $COMP_CWORD -eq 1 ]]; then\n")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n\tfi\n}\n\n", strings.Join(names, " "))
+	fmt.Fprintf(w, "complete -o default -F _archmirror archmirror\n")
+}
+
+// Escape s for the descriptions of _arguments in single quotes
+func zshQuote(s string) string {
+	return strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+func writeZshCompletion(w io.Writer) {
+	names := commandNames()
+	fmt.Fprintf(w, "#compdef archmirror\n# zsh completion for archmirror, generated by archmirror completion zsh\n\n")
+	fmt.Fprintf(w, "_archmirror() {\n\tlocal -a subcommands\n\tsubcommands=(\n")
+	for _, name := range names {
+		fmt.Fprintf(w, "\t\t'%s:%s'\n", name, zshQuote(commands[name].summary))
+	}
+	fmt.Fprintf(w, "\t)\n\n\tlocal cmd=fetch\n")
+	fmt.Fprintf(w, "\tif (( CURRENT > 2 )) && (( ${subcommands[(I)${words[2]}:*]} )); then\n")
+	fmt.Fprintf(w, "\t\tcmd=${words[2]}\n\t\tshift words\n\t\t(( CURRENT-- ))\n")
+	fmt.Fprintf(w, "\telif (( CURRENT == 2 )) && [[ ${words[2]} != -* ]]; then\n\t\t_describe command subcommands\n\t\treturn\n\tfi\n\n")
+
+	fmt.Fprintf(w, "\tcase $cmd in\n")
+	for _, name := range names {
+		flags := completionFlags(name)
+		if len(flags) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\t%s)\n\t\t_arguments", name)
+		for _, f := range flags {
+			spec := "-" + f.name + "[" + zshQuote(f.usage) + "]"
+			if f.repeated {
+				spec = "*" + spec
+			}
+			switch {
+			case f.boolean:
+			case f.values != nil:
+				spec += ":value:(" + strings.Join(f.values, " ") + ")"
+			default:
+				spec += ":value:_files"
+			}
+			fmt.Fprintf(w, " \\\n\t\t\t'%s'", spec)
+		}
+		fmt.Fprintf(w, "\n\t\t;;\n")
+	}
+	fmt.Fprintf(w, "\tesac\n}\n\n_archmirror \"$@\"\n")
+}
+
+func writeFishCompletion(w io.Writer) {
+	names := commandNames()
+	quote := strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace
+	fmt.Fprintf(w, "# fish completion for archmirror, generated by archmirror completion fish\n\n")
+	fmt.Fprintf(w, "function __archmirror_using\n\tset -l words (commandline -opc)\n\tset -l cmd fetch\n")
+	fmt.Fprintf(w, "\tif set -q words[2]; and contains -- $words[2] %s\n\t\tset cmd $words[2]\n\tend\n", strings.Join(names, " "))
+	fmt.Fprintf(w, "\tcontains -- $cmd $argv\nend\n\n")
+
+	for _, name := range names {
+		fmt.Fprintf(w, "complete -c archmirror -n __fish_use_subcommand -f -a %s -d '%s'\n", name, quote(commands[name].summary))
+	}
+	for _, name := range names {
+		flags := completionFlags(name)
+		if len(flags) == 0 {
+			continue
+		}
+		fmt.Fprintln(w)
+		for _, f := range flags {
+			line := fmt.Sprintf("complete -c archmirror -n '__archmirror_using %s' -o %s -d '%s'", name, f.name, quote(f.usage))
+			switch {
+			case f.boolean:
+			case f.values != nil:
+				line += fmt.Sprintf(" -x -a '%s'", strings.Join(f.values, " "))
+			default:
+				line += " -r -F"
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+}
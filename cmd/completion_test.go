@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PapaTutuWawa/archmirror"
+)
+
+var updateGolden = flag.Bool("update", false, "Write the golden files in testdata instead of comparing against them")
+
+// Hide the flags of the test binary from the completion, fetch uses
+// flag.CommandLine
+func withoutTestFlags(t *testing.T) {
+	t.Helper()
+	saved := flag.CommandLine
+	fs := flag.NewFlagSet(saved.Name(), flag.ContinueOnError)
+	saved.VisitAll(func(f *flag.Flag) {
+		if !strings.HasPrefix(f.Name, "test.") && f.Name != "update" {
+			fs.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	flag.CommandLine = fs
+	t.Cleanup(func() { flag.CommandLine = saved })
+}
+
+func TestCompletionGolden(t *testing.T) {
+	withoutTestFlags(t)
+	// The usage of -config names the configuration directory of the user
+	userConfig := archmirror.DefaultConfigPaths()[0]
+
+	for shell, write := range completionShells {
+		t.Run(shell, func(t *testing.T) {
+			var buf bytes.Buffer
+			write(&buf)
+			got := strings.ReplaceAll(buf.String(), userConfig, "$XDG_CONFIG_HOME/archmirror/config.toml")
+
+			golden := filepath.Join("testdata", "completion."+shell)
+			if *updateGolden {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("the %s completion differs from %s, run go test -update if that is intended:\n%s", shell, golden, got)
+			}
+		})
+	}
+}
+
+func TestCompletionCoversEveryFlag(t *testing.T) {
+	withoutTestFlags(t)
+	var buf bytes.Buffer
+	writeBashCompletion(&buf)
+	words := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(buf.String(), func(r rune) bool { return r == ' ' || r == '"' || r == '\n' }) {
+		words[word] = true
+	}
+
+	for _, name := range commandNames() {
+		if commands[name].flags == nil {
+			continue
+		}
+		commands[name].flags().VisitAll(func(f *flag.Flag) {
+			if !words["-"+f.Name] {
+				t.Errorf("-%s of %s is not completed", f.Name, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PapaTutuWawa/archmirror"
+)
+
+// Flags that are two names for the same option
+var flagAliases = map[string]string{
+	"v":         "verbose",
+	"q":         "quiet",
+	"noconfirm": "yes",
+}
+
+// Flags that make no sense in a configuration file
+var commandOnlyFlags = map[string]bool{
+	"config":              true,
+	"print-config":        true,
+	"list-countries":      true,
+	"clear-failure-cache": true,
+	"refresh":             true,
+	"interactive":         true,
+	"version":             true,
+}
+
+// Where each option got its value from. Options that are not in here have
+// their default value.
+var optionSources = make(map[string]string)
+
+// The environment variable that sets a flag, e.g. ARCHMIRROR_PROBE_TIMEOUT
+func envName(flagName string) string {
+	return "ARCHMIRROR_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Describe what a flag accepts for error messages
+func expectedFormat(f *flag.Flag) string {
+	switch f.Value.(type) {
+	case *stringList:
+		return "a comma-separated list"
+	case *regexpList:
+		return "regular expressions, one per line"
+	case *positiveDuration:
+		return "a positive duration like 5s"
+	}
+	if g, ok := f.Value.(flag.Getter); ok {
+		switch g.Get().(type) {
+		case bool:
+			return "true/false, 1/0 or yes/no"
+		case int:
+			return "an integer"
+		case float64:
+			return "a number"
+		case time.Duration:
+			return "a duration like 30s"
+		}
+	}
+
+	return "a string"
+}
+
+// Set the flags from the ARCHMIRROR_* variables that were not passed on the
+// command line
+func applyEnvironment() error {
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if _, ok := flagAliases[f.Name]; ok || err != nil {
+			return
+		}
+		name := envName(f.Name)
+		value, ok := os.LookupEnv(name)
+		if _, set := optionSources[f.Name]; !ok || set {
+			return
+		}
+
+		values := []string{value}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			switch strings.ToLower(strings.TrimSpace(value)) {
+			case "1", "true", "yes", "on":
+				values = []string{"true"}
+			case "0", "false", "no", "off":
+				values = []string{"false"}
+			}
+		} else if _, ok := f.Value.(*regexpList); ok {
+			// Patterns are set one by one. They may contain commas, as in
+			// mirror[0-9]{1,3}, so they go on lines of their own.
+			values = make([]string, 0)
+			for _, line := range strings.Split(value, "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					values = append(values, line)
+				}
+			}
+		}
+		for _, v := range values {
+			if setErr := flag.Set(f.Name, v); setErr != nil {
+				err = fmt.Errorf("invalid value %q in %s, expected %s", value, name, expectedFormat(f))
+				return
+			}
+		}
+		optionSources[f.Name] = "environment (" + name + ")"
+	})
+
+	return err
+}
+
+// Set the flags that were not passed on the command line, as parsed into
+// cmdline, from the environment and then the configuration files. Returns the warnings about
+// the files.
+func applyConfig(cmdline *flag.FlagSet) ([]string, error) {
+	cmdline.Visit(func(f *flag.Flag) {
+		optionSources[f.Name] = "command line"
+		if alias, ok := flagAliases[f.Name]; ok {
+			optionSources[alias] = "command line"
+		}
+	})
+
+	// Asking for silence on the command line overrides a verbose config and
+	// the other way around
+	overridden := make([]string, 0)
+	if _, ok := optionSources["quiet"]; ok {
+		overridden = append(overridden, "verbose", "vv")
+	} else if _, ok := optionSources["verbose"]; ok {
+		overridden = append(overridden, "quiet")
+	} else if _, ok := optionSources["vv"]; ok {
+		overridden = append(overridden, "quiet")
+	}
+	for _, name := range overridden {
+		optionSources[name] = "overridden"
+	}
+	defer func() {
+		for _, name := range overridden {
+			delete(optionSources, name)
+		}
+	}()
+
+	if err := applyEnvironment(); err != nil {
+		return nil, err
+	}
+
+	paths := archmirror.DefaultConfigPaths()
+	explicit := *configPath != ""
+	if explicit {
+		paths = []string{*configPath}
+	}
+
+	warnings := make([]string, 0)
+	for _, path := range paths {
+		config, err := archmirror.LoadConfig(path)
+		if errors.Is(err, fs.ErrNotExist) && !explicit {
+			continue
+		} else if err != nil {
+			return warnings, err
+		}
+
+		w, err := config.Apply(flag.CommandLine, optionSources)
+		warnings = append(warnings, w...)
+		if err != nil {
+			return warnings, err
+		}
+	}
+
+	return warnings, nil
+}
+
+// Quote a value for the configuration file
+func configValue(f *flag.Flag) string {
+	switch v := f.Value.(type) {
+	case *stringList:
+		return configArray(*v)
+	case *regexpList:
+		patterns := make([]string, 0, len(*v))
+		for _, p := range *v {
+			patterns = append(patterns, p.String())
+		}
+		return configArray(patterns)
+	}
+	if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+		return f.Value.String()
+	}
+
+	return strconv.Quote(f.Value.String())
+}
+
+func configArray(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, strconv.Quote(v))
+	}
+
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// Print the effective configuration in the format of the configuration file
+func printConfig(w io.Writer) {
+	flag.VisitAll(func(f *flag.Flag) {
+		if _, ok := flagAliases[f.Name]; ok || commandOnlyFlags[f.Name] {
+			return
+		}
+		source, ok := optionSources[f.Name]
+		if !ok {
+			source = "default"
+		}
+		fmt.Fprintf(w, "%s = %s # %s\n", f.Name, configValue(f), source)
+	})
+}
+
+// The options in effect as command line arguments, leaving out the ones that
+// have their default value
+func effectiveArgs() []string {
+	args := make([]string, 0)
+	flag.VisitAll(func(f *flag.Flag) {
+		if _, ok := flagAliases[f.Name]; ok || commandOnlyFlags[f.Name] {
+			return
+		}
+		if _, ok := optionSources[f.Name]; !ok {
+			return
+		}
+		// Patterns may contain commas, so each one gets its own flag
+		if patterns, ok := f.Value.(*regexpList); ok {
+			for _, p := range *patterns {
+				args = append(args, "-"+f.Name+"="+p.String())
+			}
+			return
+		}
+		args = append(args, "-"+f.Name+"="+f.Value.String())
+	})
+
+	return args
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+// Forget what applyEnvironment did to the flag once the test is done
+func resetFlag(t *testing.T, name string) {
+	t.Helper()
+	f := flag.Lookup(name)
+	t.Cleanup(func() {
+		if list, ok := f.Value.(*regexpList); ok {
+			*list = nil
+		} else if list, ok := f.Value.(*stringList); ok {
+			*list = nil
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		delete(optionSources, name)
+	})
+}
+
+func TestApplyEnvironmentPatterns(t *testing.T) {
+	resetFlag(t, "exclude")
+	t.Setenv("ARCHMIRROR_EXCLUDE", "mirror[0-9]{1,3}\\.example\n\n  (a|b),c  \n")
+
+	if err := applyEnvironment(); err != nil {
+		t.Fatal(err)
+	}
+	patterns := make([]string, 0, len(excludes))
+	for _, p := range excludes {
+		patterns = append(patterns, p.String())
+	}
+	if got, want := strings.Join(patterns, " "), `mirror[0-9]{1,3}\.example (a|b),c`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if !excludes[0].MatchString("https://mirror12.example/") {
+		t.Error("the pattern was split at its comma")
+	}
+	if source := optionSources["exclude"]; source != "environment (ARCHMIRROR_EXCLUDE)" {
+		t.Errorf("the source is %q", source)
+	}
+}
+
+func TestApplyEnvironmentInvalidPattern(t *testing.T) {
+	resetFlag(t, "exclude")
+	t.Setenv("ARCHMIRROR_EXCLUDE", "mirror\n(")
+
+	err := applyEnvironment()
+	if err == nil || !strings.Contains(err.Error(), "ARCHMIRROR_EXCLUDE") || !strings.Contains(err.Error(), "one per line") {
+		t.Errorf("got %v, want an error naming the variable and the format", err)
+	}
+}
+
+func TestApplyEnvironmentLists(t *testing.T) {
+	resetFlag(t, "country")
+	resetFlag(t, "dry-run")
+	t.Setenv("ARCHMIRROR_COUNTRY", "SE, DE")
+	t.Setenv("ARCHMIRROR_DRY_RUN", "yes")
+
+	if err := applyEnvironment(); err != nil {
+		t.Fatal(err)
+	}
+	if got := flag.Lookup("country").Value.String(); !strings.Contains(got, "SE") || !strings.Contains(got, "DE") {
+		t.Errorf("got the countries %s, want SE and DE", got)
+	}
+	if got := flag.Lookup("dry-run").Value.String(); got != "true" {
+		t.Errorf("got -dry-run %s, want true", got)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+
+	"github.com/PapaTutuWawa/archmirror/internal/desktop"
+)
+
+// After how many failed refreshes in a row -notify complains
+const failedRefreshesNotify = 3
+
+// Show a desktop notification with -notify. It is only a nicety, so failing
+// to show it is only logged.
+func notifyDesktop(ctx context.Context, urgency desktop.Urgency, summary, body string) {
+	if !*desktopNotify {
+		return
+	}
+	if err := desktop.Notify(ctx, urgency, summary, body); err != nil {
+		slog.Debug("Failed showing a desktop notification", "error", err)
+	}
+}
+
+// Describe the written mirrorlist, e.g. "10 mirrors, fastest mirror.example.org 23ms"
+func updatedMessage(sum *runSummary) string {
+	msg := fmt.Sprintf("%d mirrors", sum.Mirrors)
+
+	var fastest *summaryProbe
+	for i, p := range sum.Probes {
+		if p.Error != "" || p.LatencyMS == 0 || !slices.Contains(sum.Result, p.URL) {
+			continue
+		}
+		if fastest == nil || p.LatencyMS < fastest.LatencyMS {
+			fastest = &sum.Probes[i]
+		}
+	}
+	if fastest != nil {
+		host := fastest.URL
+		if u, err := url.Parse(fastest.URL); err == nil && u.Host != "" {
+			host = u.Hostname()
+		}
+		msg += fmt.Sprintf(", fastest %s %.0fms", host, fastest.LatencyMS)
+	}
+
+	return msg
+}
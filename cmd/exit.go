@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/PapaTutuWawa/archmirror"
+)
+
+// The exit codes, so that scripts can tell what went wrong
+const (
+	exitOK = 0
+	// Invalid flags or configuration, and everything that is not covered
+	// below
+	exitUsage = 1
+	// archlinux.org or the mirrors could not be reached
+	exitNetwork = 2
+	// archlinux.org sent something that is not a usable mirrorlist
+	exitInvalid = 3
+	// A file could not be read or written
+	exitFilesystem = 4
+	// The user interrupted us
+	exitInterrupted = 5
+	// The -exec command failed with -exec-required
+	exitHook = 6
+	// Another archmirror is writing the same output file
+	exitLocked = 7
+	// archlinux.org rate limited us (EX_TEMPFAIL)
+	exitRateLimited = 75
+)
+
+// An error with the exit code it results in
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func usageError(format string, a ...any) error {
+	return &exitError{exitUsage, fmt.Errorf(format, a...)}
+}
+
+func networkError(format string, a ...any) error {
+	return &exitError{exitNetwork, fmt.Errorf(format, a...)}
+}
+
+func invalidError(format string, a ...any) error {
+	return &exitError{exitInvalid, fmt.Errorf(format, a...)}
+}
+
+func filesystemError(format string, a ...any) error {
+	return &exitError{exitFilesystem, fmt.Errorf(format, a...)}
+}
+
+// Returned when there is nothing left to do, e.g. after printing the help
+var errDone = errors.New("done")
+
+// The flag package already printed what is wrong
+var errReported = errors.New("already reported")
+
+// The exit code for err. Interruptions, rate limiting and unusable responses
+// win over the code of the step that failed.
+func exitCode(err error) int {
+	var limited *archmirror.RateLimitError
+	var exit *exitError
+	switch {
+	case err == nil, errors.Is(err, errDone):
+		return exitOK
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.As(err, &limited):
+		return exitRateLimited
+	case errors.Is(err, archmirror.ErrHTMLResponse), errors.Is(err, archmirror.ErrNotPlaintext), errors.Is(err, archmirror.ErrNotJSON), errors.Is(err, archmirror.ErrEmptyMirrorlist):
+		return exitInvalid
+	case errors.As(err, &exit):
+		return exit.code
+	}
+
+	return exitUsage
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/PapaTutuWawa/archmirror"
+)
+
+func TestExitCode(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, exitOK},
+		{"help", errDone, exitOK},
+		{"flag error", errReported, exitUsage},
+		{"untyped", errors.New("something broke"), exitUsage},
+		{"usage", usageError("Invalid tier!"), exitUsage},
+		{"network", networkError("Failed fetching: %w", errors.New("connection refused")), exitNetwork},
+		{"invalid", invalidError("Not a mirrorlist"), exitInvalid},
+		{"filesystem", filesystemError("Failed writing: %w", errors.New("read-only file system")), exitFilesystem},
+		{"hook", &exitError{exitHook, errors.New("The -exec command failed")}, exitHook},
+		{"locked", &exitError{exitLocked, errors.New("locked")}, exitLocked},
+		{"interrupted", &exitError{exitInterrupted, errors.New("Not replacing the mirrorlist")}, exitInterrupted},
+		// The cause wins over the step that failed
+		{"canceled fetch", networkError("Failed fetching: %w", context.Canceled), exitInterrupted},
+		{"canceled write", filesystemError("Failed writing: %w", context.Canceled), exitInterrupted},
+		{"rate limited", networkError("Failed fetching: %w", &archmirror.RateLimitError{URL: archmirror.ArchLinuxUrl}), exitRateLimited},
+		{"HTML", networkError("Failed fetching: %w", archmirror.ErrHTMLResponse), exitInvalid},
+		{"not plaintext", networkError("Failed fetching: %w", archmirror.ErrNotPlaintext), exitInvalid},
+		{"not JSON", networkError("Failed fetching: %w", archmirror.ErrNotJSON), exitInvalid},
+		{"empty", fmt.Errorf("requesting: %w", archmirror.ErrEmptyMirrorlist), exitInvalid},
+	} {
+		if got := exitCode(tc.err); got != tc.want {
+			t.Errorf("%s: exitCode(%v) = %d, want %d", tc.name, tc.err, got, tc.want)
+		}
+	}
+}
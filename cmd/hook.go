@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// Run the -exec command with the shell after the mirrorlist was written. It
+// gets what happened in its environment and shares our output.
+func runHook(ctx context.Context, command string, sum *runSummary) error {
+	out, err := filepath.Abs(sum.Output)
+	if err != nil {
+		out = sum.Output
+	}
+	changed := "0"
+	if sum.Changed {
+		changed = "1"
+	}
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Stdout, cmd.Stderr = os.Stdout, stderr
+	cmd.Env = append(os.Environ(),
+		"ARCHMIRROR_OUT="+out,
+		"ARCHMIRROR_MIRROR_COUNT="+strconv.Itoa(sum.Mirrors),
+		"ARCHMIRROR_CHANGED="+changed,
+	)
+	slog.Debug("Running the -exec command", "command", command)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%q: %w", command, err)
+	}
+	slog.Debug("The -exec command succeeded")
+
+	return nil
+}
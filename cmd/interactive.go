@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/PapaTutuWawa/archmirror"
+)
+
+// Parse a selection like "1,3,5-8" of the mirrors 1 to n. Returns the
+// indices starting at 0, in the order they were given.
+func parseSelection(s string, n int) ([]int, error) {
+	selected := make([]int, 0)
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number or a range like 5-8", part)
+		}
+		last := first
+		if isRange {
+			last, err = strconv.Atoi(strings.TrimSpace(to))
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a number or a range like 5-8", part)
+			}
+			if last < first {
+				return nil, fmt.Errorf("the range %q is backwards", part)
+			}
+		}
+		if first < 1 || last > n {
+			return nil, fmt.Errorf("%q is not between 1 and %d", part, n)
+		}
+
+		for i := first; i <= last; i++ {
+			if seen[i] {
+				return nil, fmt.Errorf("mirror %d is selected twice", i)
+			}
+			seen[i] = true
+			selected = append(selected, i-1)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, errors.New("nothing selected")
+	}
+
+	return selected, nil
+}
+
+// Show the mirrors
+func printSelectionTable(w io.Writer, l *archmirror.Mirrorlist) {
+	t := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(t, "#\tCOUNTRY\tLATENCY\tRATE\tSCORE\tLAG\tMIRROR")
+	for i, m := range l.Mirrors {
+		latency, rate, score := "-", "-", "-"
+		if m.Latency > 0 {
+			latency = m.Latency.Round(time.Millisecond).String()
+		}
+		if m.Rate > 0 {
+			rate = archmirror.FormatRate(m.Rate)
+		}
+		if m.Status != nil && m.Status.Score != nil {
+			score = fmt.Sprintf("%.2f", *m.Status.Score)
+		}
+		fmt.Fprintf(t, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", i+1, m.Country, latency, rate, score, formatLag(m.Lag), m.URL)
+	}
+	t.Flush()
+}
+
+// Let the user pick the mirrors to keep and their order. Asks again until the
+// answer is valid.
+func promptSelection(in io.Reader, out io.Writer, l *archmirror.Mirrorlist) ([]int, error) {
+	printSelectionTable(out, l)
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(out, "\nMirrors to write, in order (e.g. 1,3,5-8): ")
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, errors.New("no selection was made")
+		}
+
+		selected, err := parseSelection(scanner.Text(), len(l.Mirrors))
+		if err == nil {
+			return selected, nil
+		}
+		fmt.Fprintf(out, "Invalid selection: %v\n", err)
+	}
+}
+
+// Ask a yes/no question, no is the default
+func confirm(in io.Reader, out io.Writer, question string) (bool, error) {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && answer == "" {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+// Show how the new list differs from the file it replaces and ask whether to
+// go ahead
+func confirmReplace(l *archmirror.Mirrorlist) (bool, error) {
+	old, err := archmirror.ReadMirrorlistFile(*outputFile)
+	if err == nil {
+		fmt.Fprintf(os.Stderr, "%s has %d mirrors\n", *outputFile, len(old.Mirrors))
+		// -diff already showed it
+		if diff := archmirror.DiffMirrorlists(old, l); !diff.Empty() && !*showDiff {
+			diff.Write(os.Stderr, *outputFile, *outputFile+" (new)")
+		}
+	}
+
+	return confirm(os.Stdin, os.Stderr, fmt.Sprintf("Replace existing mirrorlist with %d mirrors?", len(l.Mirrors)))
+}
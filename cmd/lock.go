@@ -0,0 +1,18 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// Another archmirror is writing the same file
+var errLocked = errors.New("another archmirror is running")
+
+// How often a held lock is tried again while waiting for it
+const lockPoll = 100 * time.Millisecond
+
+// The lock file that keeps two runs from writing the output file at the same
+// time
+func lockPath() string {
+	return *outputFile + ".lock"
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// There is no flock here, so runs are not kept apart
+func lockFile(ctx context.Context, path string, timeout time.Duration) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/PapaTutuWawa/archmirror"
+	"github.com/PapaTutuWawa/archmirror/internal/style"
+)
+
+// A handler for people reading the terminal: just the message and the
+// attributes, without timestamps or levels except for warnings and errors
+type humanHandler struct {
+	w     io.Writer
+	mu    *sync.Mutex
+	level slog.Leveler
+	attrs []slog.Attr
+	// Colors warnings and errors
+	style style.Style
+}
+
+func newHumanHandler(w io.Writer, level slog.Leveler, s style.Style) *humanHandler {
+	return &humanHandler{w: w, mu: &sync.Mutex{}, level: level, style: s}
+}
+
+func (h *humanHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *humanHandler) Handle(_ context.Context, r slog.Record) error {
+	var b bytes.Buffer
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString("Error: ")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString("Warning: ")
+	}
+	b.WriteString(r.Message)
+
+	writeAttr := func(a slog.Attr) bool {
+		value := a.Value.Resolve()
+		if d, ok := value.Any().(time.Duration); ok {
+			value = slog.StringValue(d.String())
+		}
+		fmt.Fprintf(&b, " %s=%v", a.Key, value)
+		return true
+	}
+	for _, a := range h.attrs {
+		writeAttr(a)
+	}
+	r.Attrs(writeAttr)
+
+	line := b.String()
+	switch {
+	case r.Level >= slog.LevelError:
+		line = h.style.Error(line)
+	case r.Level >= slog.LevelWarn:
+		line = h.style.Warning(line)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, line+"\n")
+	return err
+}
+
+func (h *humanHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &humanHandler{
+		w:     h.w,
+		mu:    h.mu,
+		level: h.level,
+		attrs: append(append([]slog.Attr{}, h.attrs...), attrs...),
+		style: h.style,
+	}
+}
+
+// Groups are not used, so they are simply flattened
+func (h *humanHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// The names accepted by -log-format
+var logFormats = []string{"text", "json"}
+
+// Create the logger for the given -log-format that drops everything below
+// level. Only text is styled with s.
+func newLogger(w io.Writer, format string, level slog.Level, s style.Style) (*slog.Logger, error) {
+	switch format {
+	case "text":
+		return slog.New(newHumanHandler(w, level, s)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+			Level: level,
+			ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+				// Name our extra level
+				if a.Key == slog.LevelKey && a.Value.Any() == slog.Level(archmirror.LevelTrace) {
+					a.Value = slog.StringValue("TRACE")
+				}
+				return a
+			},
+		})), nil
+	}
+
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
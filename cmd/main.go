@@ -1,206 +1,1540 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
+	"log/slog"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"regexp"
+	"slices"
 	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/PapaTutuWawa/archmirror"
+	"github.com/PapaTutuWawa/archmirror/internal/desktop"
+	"github.com/PapaTutuWawa/archmirror/internal/sdnotify"
+	"github.com/PapaTutuWawa/archmirror/internal/style"
+	"github.com/PapaTutuWawa/archmirror/internal/version"
 )
 
-type IPVersion uint8
-type ProtocolType uint8
+// A flag that can be passed multiple times and also accepts a comma-separated
+// list of values
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			*l = append(*l, v)
+		}
+	}
+
+	return nil
+}
+
+// A flag holding a duration that has to be greater than zero
+type positiveDuration time.Duration
+
+func (d *positiveDuration) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *positiveDuration) Set(value string) error {
+	v, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	if v <= 0 {
+		return errors.New("duration must be greater than zero")
+	}
+
+	*d = positiveDuration(v)
+	return nil
+}
+
+// A flag holding a number of bytes like 512K or 2M
+type byteSize int64
+
+func (b *byteSize) String() string {
+	return archmirror.FormatBytes(int64(*b))
+}
+
+func (b *byteSize) Set(value string) error {
+	n, err := archmirror.ParseByteSize(value)
+	if err != nil {
+		return err
+	}
+
+	*b = byteSize(n)
+	return nil
+}
+
+// A flag that compiles each value as a regular expression
+type regexpList []*regexp.Regexp
+
+func (l *regexpList) String() string {
+	patterns := make([]string, 0, len(*l))
+	for _, p := range *l {
+		patterns = append(patterns, p.String())
+	}
+
+	return strings.Join(patterns, " ")
+}
+
+func (l *regexpList) Set(value string) error {
+	p, err := regexp.Compile(value)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %v", value, err)
+	}
+
+	*l = append(*l, p)
+	return nil
+}
+
+// Create a context that is cancelled on the first SIGINT or SIGTERM. A second
+// signal exits immediately. The returned function stops listening for signals.
+func interruptContext(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 
-const (
-	// Other constants
-	ArchLinuxUrl string = "https://www.archlinux.org/mirrorlist/"
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-signals:
+		case <-done:
+			return
+		}
+		slog.Info("Interrupted, press Ctrl-C again to quit immediately")
+		cancel()
+
+		select {
+		case <-signals:
+			os.Exit(exitInterrupted)
+		case <-done:
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+}
 
-	// IPv4 or IPv6
-	IPVersion4 IPVersion = iota
-	IPVersion6
+// Set up the flags
+var (
+	// Options affecting the mirrorlist
+	IPv4          = flag.Bool("4", true, "Include IPv4 mirrors")
+	IPv6          = flag.Bool("6", false, "Include IPv6 mirrors")
+	requireIPv4   = flag.Bool("require-ipv4-reachable", false, "Probe the mirrors over IPv4 only and drop the ones that cannot be reached over it")
+	requireIPv6   = flag.Bool("require-ipv6-reachable", false, "Probe the mirrors over IPv6 only and drop the ones that cannot be reached over it")
+	useHTTP       = flag.Bool("http", false, "Include HTTP mirrors")
+	useHTTPS      = flag.Bool("https", true, "Include HTTPS mirrors")
+	protocolNames stringList
+	countryNames  stringList
+	allCountries  = flag.Bool("all-countries", false, "Include mirrors from all countries")
+	useStatus     = flag.Bool("status", false, "Fetch the mirror status from archlinux.org")
+	completion    = flag.Float64("completion-percent", 0, "Remove mirrors that passed less than this percentage of the status checks")
+	maxAge        = flag.Float64("age", 0, "Remove mirrors that last synced more than this many hours ago")
+	maxDelay      = flag.Duration("max-delay", 0, "Remove mirrors that are further behind than this")
+	tier          = flag.Int("tier", -1, "Only keep mirrors of this tier, -1 keeps all")
+	keepUnknown   = flag.Bool("keep-unknown", false, "Keep mirrors without a status when filtering by status")
+	uncomment     = flag.Bool("uncomment", true, "Activate the mirrors that the generator comments out")
+	noValidate    = flag.Bool("no-validate", false, "Do not check the country codes before sending the request")
+	retries       = flag.Int("retries", archmirror.DefaultRetries, "How often to retry a failed mirrorlist request")
+	proxy         = flag.String("proxy", "", "Send all requests through this HTTP(S) or SOCKS5 proxy instead of the one from the environment")
+	caFile        = flag.String("ca-file", "", "Also trust the certificates in this PEM file")
+	insecure      = flag.Bool("insecure", false, "Do not verify TLS certificates (dangerous, only for debugging)")
+	noRedirects   = flag.Bool("no-follow-redirects", false, "Report redirects of archlinux.org instead of following them, for debugging custom -url endpoints")
+	userAgent     = flag.String("user-agent", "", "Send this User-Agent instead of archmirror/<version>")
+	timeout       = flag.Duration("timeout", 30*time.Second, "Give up on requests to archlinux.org after this long, 0 means no limit")
+	generatorURL  = flag.String("url", archmirror.ArchLinuxUrl, "Ask the mirrorlist generator at this URL")
+	strict        = flag.Bool("strict", false, "Fail if the mirrors of one of several countries cannot be requested or a Server line is invalid")
+	flavorName    = flag.String("flavor", "arch", "The distribution whose mirrors are fetched ("+strings.Join(archmirror.FlavorNames(), ", ")+")")
+	testFile      = flag.String("test-file", "", "Download this file below the root of every mirror for -rank rate, e.g. extra/os/$arch/extra.db, instead of the core database")
+	archName      = flag.String("arch", "", "The architecture whose databases are downloaded while ranking ("+strings.Join(archmirror.KnownArches, ", ")+"), the one of this machine if the mirrors have it")
+	unknownArch   = flag.Bool("allow-unknown-arch", false, "Accept an -arch that archmirror does not know")
+	branch        = flag.String("branch", "stable", "The Manjaro branch with -flavor manjaro ("+strings.Join(archmirror.ManjaroBranches, ", ")+")")
 
-	// HTTP or HTTPS
-	ProtocolTypeHTTP ProtocolType = iota
-	ProtocolTypeHTTPS
+	// Options affecting the selection and order of the mirrors
+	inputFile         = flag.String("in", "", "Take the mirrors from this mirrorlist instead of fetching them, - reads a mirrorlist or a list of URLs from standard input")
+	inputCommented    = flag.Bool("in-commented", false, "Also use the commented out mirrors of -in")
+	excludes          regexpList
+	includeFrom       = flag.String("include-from", "", "Only keep the mirrors whose hostname or URL prefix is listed in the file")
+	keepExcluded      = flag.Bool("keep-excluded-commented", false, "Write excluded mirrors as commented out lines")
+	shuffle           = flag.Bool("shuffle", false, "Randomize the order of the mirrors within each country")
+	probeTimeout      = positiveDuration(archmirror.DefaultProbeTimeout)
+	probeMaxBytes     = byteSize(archmirror.DefaultRateSampleBytes)
+	probeMaxTotal     byteSize
+	probeWarmup       = flag.Bool("warmup", false, "Request a file from each mirror before measuring it, so that connecting to it is not measured")
+	probeSamples      = flag.Int("samples", 1, "Measure the latency of each mirror this often and rank by the median")
+	probeThreads      = flag.Int("threads", archmirror.DefaultProbeThreads, "Number of mirrors to probe at the same time")
+	rankMode          = flag.String("rank", "", "Rank the mirrors by the given measurement (latency, rate)")
+	sortKey           = flag.String("sort", "", "Sort the mirrors by these comma-separated keys, each one breaking the ties of the one before ("+strings.Join(sortKeyNames(), ", ")+")")
+	dropUnscored      = flag.Bool("drop-unscored", false, "Remove mirrors without a score when sorting by score")
+	failureExpiry     = flag.Duration("failure-expiry", archmirror.DefaultFailureExpiry, "How long mirrors that failed a probe are skipped")
+	noFailureCache    = flag.Bool("no-failure-cache", false, "Do not remember mirrors that failed a probe")
+	noCache           = flag.Bool("no-cache", false, "Always download the whole mirrorlist instead of reusing the cached copy")
+	cacheTTL          = flag.Duration("cache-ttl", time.Hour, "Use a cached mirrorlist younger than this without asking archlinux.org, 0 always asks")
+	refreshCache      = flag.Bool("refresh", false, "Ask archlinux.org even if the cached mirrorlist is recent")
+	clearFailureCache = flag.Bool("clear-failure-cache", false, "Forget all mirrors that failed a probe")
+	verifySync        = flag.Bool("verify-sync", false, "Check the lastsync file of every mirror while ranking and drop the ones that synced too long ago")
+	maxSyncAge        = flag.Duration("max-sync-age", archmirror.DefaultMaxSyncAge, "How long ago a mirror may have synced with -verify-sync")
+	maxLag            = flag.Duration("max-lag", 0, "Drop mirrors whose lastupdate is further behind the one of the master mirror than this while ranking, 0 keeps all")
+	keepUnknownSync   = flag.Bool("keep-unknown-sync", false, "Keep mirrors without a usable lastsync file with -verify-sync")
+	writePartial      = flag.Bool("write-partial", false, "Write the mirrors measured so far when ranking is interrupted")
+	deadline          = flag.Duration("deadline", 0, "Give up when the whole run takes longer than this, 0 means no limit")
+	limit             = flag.Int("n", 0, "Maximum number of mirrors to write, 0 writes all")
+	activateTop       = flag.Int("activate-top", 0, "Only activate this many mirrors and write the rest as commented out fallbacks")
+	groupByCountry    = flag.Bool("group-by-country", false, "Write the mirrors of each country together under one heading, keeping their order otherwise")
+	interactive       = flag.Bool("interactive", false, "Show the mirrors and ask which ones to write, in which order")
+	minMirrors        = flag.Int("min-mirrors", 1, "Fail instead of writing a mirrorlist with fewer active mirrors than this")
+
+	// Everything else
+	verbose       = flag.Bool("verbose", false, "Print more information about what is happening")
+	quiet         = flag.Bool("quiet", false, "Only print errors")
+	debug         = flag.Bool("vv", false, "Print even more information, including every probe")
+	logFormat     = flag.String("log-format", "text", "Format of the messages on stderr ("+strings.Join(logFormats, ", ")+")")
+	colorMode     = flag.String("color", "auto", "Color the warnings and errors on stderr ("+strings.Join(style.Modes, ", ")+"), auto colors them on a terminal unless NO_COLOR is set")
+	outputFile    = flag.String("out", "mirrorlist", "Output file (- for standard output)")
+	force         = flag.Bool("force", false, "Overwrite the output file if it already exists")
+	assumeYes     = flag.Bool("yes", false, "Do not ask before replacing the output file")
+	forceWrite    = flag.Bool("force-write", false, "Write the output file even if only its header would change")
+	backup        = flag.Bool("backup", false, "Back up the output file before overwriting it")
+	backupKeep    = flag.Int("backup-keep", -1, "Number of backups to keep after writing, -1 keeps all")
+	noBackup      = flag.Bool("no-backup", false, "Never back up the output file, even with -backup")
+	noHeader      = flag.Bool("no-header", false, "Do not write the archmirror header with the time and parameters of the run")
+	merge         = flag.Bool("merge", false, "Keep the mirrors of the output file that are not in the new list at the top")
+	showDiff      = flag.Bool("diff", false, "Show how the mirrors differ from the existing output file")
+	dryRun        = flag.Bool("dry-run", false, "Show what would be written instead of writing the output file")
+	toStdout      = flag.Bool("stdout", false, "Write the mirrorlist to standard output instead of a file")
+	outputFormat  = flag.String("output-format", "pacman", "Format of the output ("+strings.Join(archmirror.OutputFormatNames(), ", ")+")")
+	configPath    = flag.String("config", "", "Read the options from this file instead of "+strings.Join(archmirror.DefaultConfigPaths(), " and "))
+	printConfigs  = flag.Bool("print-config", false, "Print the options after reading the configuration files and exit")
+	listCountries = flag.Bool("list-countries", false, "Print the countries the generator offers and exit")
+	jsonOutput    = flag.Bool("json", false, "Print the country list as JSON")
+	daemon        = flag.Bool("daemon", false, "Keep running and refresh the mirrorlist every -interval, replacing the output file")
+	interval      = flag.Duration("interval", 12*time.Hour, "How often to refresh the mirrorlist with -daemon")
+	showVersion   = flag.Bool("version", false, "Print the version of archmirror and exit")
+	desktopNotify = flag.Bool("notify", false, "Show a desktop notification when -daemon changes the mirrorlist or keeps failing")
+	lockTimeout   = flag.Duration("lock-timeout", 0, "Wait this long for another archmirror writing the same output file, 0 gives up right away")
+	execHook      = flag.String("exec", "", "Run this shell command after the output file was written")
+	execRequired  = flag.Bool("exec-required", false, "Fail if the -exec command fails instead of only reporting it")
+	summaryJSON   = flag.String("summary-json", "", "Also write the summary of each run as JSON to this file")
+	summaryFormat = flag.String("summary-format", "text", "Format of the summary on stderr at the end of a run ("+strings.Join(summaryFormats, ", ")+")")
 )
 
-// The configuration of the mirrorlist
-type MirrorListConfig struct {
-	Protocols  []ProtocolType
-	IPVersions []IPVersion
-	Country    string
+func init() {
+	flag.Var(&protocolNames, "protocol", "Include mirrors with this protocol (http, https, rsync), overrides -http and -https (may be repeated or comma-separated)")
+	flag.Var(&countryNames, "country", "Mirror location as country code or name (may be repeated or comma-separated)")
+	flag.Var(&excludes, "exclude", "Remove mirrors whose URL or hostname matches the regular expression (may be repeated)")
+	flag.BoolVar(verbose, "v", false, "Short for -verbose")
+	flag.BoolVar(quiet, "q", false, "Short for -quiet")
+	flag.BoolVar(assumeYes, "noconfirm", false, "Same as -yes")
+	flag.Var(&probeTimeout, "probe-timeout", "How long to wait for a single mirror when ranking")
+	flag.Var(&probeMaxBytes, "probe-max-bytes", "How much -rank rate downloads from each mirror, e.g. 512K")
+	flag.Var(&probeMaxTotal, "probe-max-total", "How much -rank rate downloads in total, the remaining mirrors are only measured by latency (0 for no limit)")
+}
+
+// The IP version the probes are restricted to by -require-ipv4-reachable or
+// -require-ipv6-reachable
+func probeIPVersion() (archmirror.IPVersion, bool) {
+	switch {
+	case *requireIPv4:
+		return archmirror.IPVersion4, true
+	case *requireIPv6:
+		return archmirror.IPVersion6, true
+	}
+	return 0, false
+}
+
+// Whether there is a file at path
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Check whether the flag was passed on the command line
+func isFlagSet(name string) bool {
+	found := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+
+	return found
 }
 
-// Convert the protocol to an URL parameter
-func (t *ProtocolType) ToParameter() string {
-	ret := "protocol="
+// Load the cache of mirrors that failed their probes. Returns nil if the
+// cache is disabled or cannot be used.
+func loadFailureCache() *archmirror.FailureCache {
+	if *noFailureCache {
+		return nil
+	}
+
+	path, err := archmirror.DefaultFailureCachePath()
+	if err != nil {
+		slog.Warn("Not using the failure cache", "error", err)
+		return nil
+	}
+	cache, err := archmirror.LoadFailureCache(path)
+	if err != nil {
+		// A broken cache is simply started anew
+		slog.Warn("Ignoring the failure cache", "error", err)
+		cache = archmirror.NewFailureCache(path)
+	}
+	cache.Expire(*failureExpiry, time.Now())
+
+	return cache
+}
 
-	switch *t {
-	case ProtocolTypeHTTP:
-		ret += "http"
-	case ProtocolTypeHTTPS:
-		ret += "https"
+// Whether the output file already contains data, apart from the header with
+// the time of the run
+func unchanged(data []byte) bool {
+	old, err := os.ReadFile(*outputFile)
+	if err != nil {
+		return false
+	}
+	if *outputFormat != "pacman" {
+		return bytes.Equal(old, data)
 	}
 
-	return ret
+	same, err := archmirror.SameMirrorlistBody(old, data)
+	return err == nil && same
 }
 
-// Convert the IP version to an URL parameter
-func (t *IPVersion) ToParameter() string {
-	ret := "ip_version="
+// Open the cache of the mirrorlists the generator sent. Returns nil if it
+// cannot be used.
+func openResponseCache() *archmirror.ResponseCache {
+	dir, err := archmirror.DefaultResponseCacheDir()
+	if err != nil {
+		slog.Warn("Not caching the mirrorlist", "error", err)
+		return nil
+	}
 
-	switch *t {
-	case IPVersion4:
-		ret += "4"
-	case IPVersion6:
-		ret += "6"
+	ttl := *cacheTTL
+	if *refreshCache {
+		ttl = 0
 	}
 
-	return ret
+	return archmirror.NewResponseCache(dir, ttl)
 }
 
-func RequestMirrorList(c *MirrorListConfig) (*[]string, error) {
-	parameters := make([]string, 0)
-	// Build the Parameters
-	// Protocols
-	for _, v := range c.Protocols {
-		parameters = append(parameters, v.ToParameter())
+// Create the transport shared by all requests
+func newTransport() (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if err := configureTLS(transport); err != nil {
+		return nil, err
+	}
+	if *proxy == "" {
+		return transport, nil
 	}
 
-	// IP versions
-	for _, v := range c.IPVersions {
-		parameters = append(parameters, v.ToParameter())
+	u, err := url.Parse(*proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy: %w", err)
+	}
+	// Go always lets a SOCKS5 proxy resolve the hostnames, so socks5 behaves
+	// like socks5h
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("no host in proxy URL %q", u.Redacted())
+	}
+	transport.Proxy = http.ProxyURL(u)
+
+	return transport, nil
+}
+
+// Apply -ca-file and -insecure to the transport
+func configureTLS(transport *http.Transport) error {
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+
+	if *caFile != "" {
+		data, err := os.ReadFile(*caFile)
+		if err != nil {
+			return err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in %s", *caFile)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	if *insecure {
+		slog.Warn("TLS certificates are not verified, anyone on the network can tamper with the mirrorlist!")
+		transport.TLSClientConfig.InsecureSkipVerify = true
 	}
 
-	// Country
-	parameters = append(parameters, "country="+c.Country)
+	return nil
+}
 
-	// Build the URL and try to send the request
-	urlParameters := "?" + strings.Join(parameters, "&")
-	resp, err := http.Get(ArchLinuxUrl + urlParameters)
+// Log the proxy that requests to archlinux.org go through
+func logProxy(transport *http.Transport) {
+	req, err := http.NewRequest(http.MethodGet, *generatorURL, nil)
+	if err != nil {
+		return
+	}
+	u, err := transport.Proxy(req)
 	if err != nil {
-		return &[]string{}, err
+		slog.Warn("Invalid proxy", "error", err)
+	} else if u == nil {
+		slog.Debug("Not using a proxy")
+	} else {
+		slog.Debug("Using a proxy", "proxy", u.Redacted())
 	}
+}
 
-	// If we don't receive plaintext content: Bail out!
-	if resp.Header.Get("Content-Type") != "text/plain" {
-		return &[]string{}, errors.New("Expected plaintext, got something else")
+// The filters selected on the command line that use the mirror status
+func statusFilters(ctx context.Context, client *http.Client, report *archmirror.StatusReport) []archmirror.Filter {
+	filters := make([]archmirror.Filter, 0)
+	if report == nil {
+		return filters
 	}
 
-	// Read the data that is sent in the body
-	strBuf := make([]string, 0)
-	reader := bufio.NewReader(resp.Body)
-	for {
-		str, err := reader.ReadString('\n')
+	if *completion > 0 {
+		filters = append(filters, archmirror.CompletionFilter(*completion, *keepUnknown))
+	}
+	if *maxAge > 0 {
+		age := time.Duration(*maxAge * float64(time.Hour))
+		filters = append(filters, archmirror.AgeFilter(age, report.LastCheck, *keepUnknown))
+	}
+	if *maxDelay > 0 {
+		filters = append(filters, archmirror.DelayFilter(*maxDelay, *keepUnknown))
+	}
+	if *tier >= 0 {
+		filters = append(filters, archmirror.TierFilter(*tier, archmirror.NewTierResolverContext(ctx, client)))
+	}
 
-		if strings.Contains(str, "<!DOCTYPE html>") {
-			fmt.Println("Found an HTML tag. Perhaps got HTML?")
-			fmt.Println("Mirrorlist may not work!")
+	return filters
+}
+
+// Start the header with the version, time and parameters of the run
+func describeConfig(l *archmirror.Mirrorlist, f archmirror.Flavor, c *archmirror.MirrorListConfig) {
+	protocols := make([]string, 0, len(c.Protocols))
+	for _, p := range c.Protocols {
+		protocols = append(protocols, p.String())
+	}
+	versions := make([]string, 0, len(c.IPVersions))
+	for _, v := range c.IPVersions {
+		versions = append(versions, v.String())
+	}
+
+	l.AddHeaderNote(fmt.Sprintf("Generated by archmirror %s at %s", version.Version(), l.Generated.UTC().Format(time.RFC3339)))
+	if *inputFile != "" {
+		source := *inputFile
+		if source == "-" {
+			source = "standard input"
 		}
+		l.AddHeaderNote("Mirrors from " + source)
+		return
+	}
+	l.AddHeaderNote("Countries: " + strings.Join(c.Countries, ", "))
+	l.AddHeaderNote("Protocols: " + strings.Join(protocols, ", "))
+	l.AddHeaderNote("IP versions: " + strings.Join(versions, ", "))
+	if _, ok := f.(archmirror.ArchFlavor); !ok {
+		l.AddHeaderNote("Flavor: " + f.Name())
+	}
+	if c.BaseURL != "" && c.BaseURL != archmirror.ArchLinuxUrl {
+		l.AddHeaderNote("Generator: " + c.BaseURL)
+	}
+}
 
-		// Already activate the mirrors"
-		str = strings.Replace(str, "#Server", "Server", -1)
-		strBuf = append(strBuf, str)
+// How many Server lines -dry-run shows
+const dryRunLines = 10
 
-		// We will read the response stream until an error occurs, which
-		// should be when the EOF is reached
-		if err != nil {
+// Show what would be written instead of touching the output file
+func printDryRun(l *archmirror.Mirrorlist, f archmirror.Flavor, c *archmirror.MirrorListConfig) {
+	if *inputFile == "-" {
+		fmt.Println("Read standard input")
+	} else if *inputFile != "" {
+		fmt.Printf("Read %s\n", *inputFile)
+	} else if c.UsesGenerator() {
+		if url, err := f.Source(c); err == nil {
+			fmt.Printf("Requested %s\n", url)
+		}
+	}
+	fmt.Printf("Would write %d mirrors to %s\n", len(l.Mirrors), *outputFile)
+	for i := range l.Mirrors {
+		if i == dryRunLines {
+			fmt.Printf("... and %d more\n", len(l.Mirrors)-dryRunLines)
 			break
 		}
+		fmt.Println(l.Mirrors[i].Line())
 	}
+}
 
-	return &strBuf, nil
+// How far a mirror is behind the master mirror, - if unknown
+func formatLag(lag *time.Duration) string {
+	if lag == nil {
+		return "-"
+	}
+	return lag.Round(time.Second).String()
 }
 
-// Set up the flags
-var (
-	// Options affecting the mirrorlist
-	IPv4        = flag.Bool("4", true, "Include IPv4 mirrors")
-	IPv6        = flag.Bool("6", false, "Include IPv6 mirrors")
-	useHTTP     = flag.Bool("http", false, "Include HTTP mirrors")
-	useHTTPS    = flag.Bool("https", true, "Include HTTPS mirrors")
-	CountryCode = flag.String("country", "", "Mirror location")
+// Print the measured download rates
+func printRateTable(s *archmirror.RankSummary) {
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MIRROR\tRATE\tELAPSED\tLAG")
+	for _, r := range s.Results {
+		if r.Err != nil {
+			continue
+		}
+		rate := archmirror.FormatRate(r.Mirror.Rate)
+		if r.LatencyOnly {
+			rate = "- (latency only)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Mirror.URL, rate, r.Elapsed.Round(time.Millisecond), formatLag(r.Mirror.Lag))
+	}
+	w.Flush()
+}
 
-	// Everything else
-	outputFile = flag.String("out", "mirrorlist", "Output file")
-)
+// Show the spread of the latency samples
+func printLatencyTable(s *archmirror.RankSummary) {
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MIRROR\tMEDIAN\tMIN\tMAX\tSAMPLES")
+	for _, r := range s.Results {
+		if r.Err != nil {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d/%d\n", r.Mirror.URL, r.Mirror.Latency.Round(time.Millisecond), r.MinLatency.Round(time.Millisecond), r.MaxLatency.Round(time.Millisecond), r.Samples, *probeSamples)
+	}
+	w.Flush()
+}
+
+// Print the countries the generator offers as a table or as JSON
+func printCountries(ctx context.Context, client *http.Client, asJSON bool) error {
+	countries, err := archmirror.RequestCountriesFrom(ctx, client, *generatorURL)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(countries)
+	}
+
+	for _, c := range countries {
+		fmt.Printf("%-4s %s\n", c.Code, c.Name)
+	}
+
+	return nil
+}
 
 func main() {
+	err := run(os.Args[1:])
+	if err != nil && !errors.Is(err, errDone) && !errors.Is(err, errReported) {
+		fmt.Fprintln(os.Stderr, colors.Error(err.Error()))
+	}
+	os.Exit(exitCode(err))
+}
+
+// Fetch, filter, rank and write a mirrorlist
+func fetch(args []string) error {
 	// Prepare the MirrorListConfig
-	r := &MirrorListConfig{
-		Protocols:  []ProtocolType{},
-		IPVersions: []IPVersion{},
-		Country:    "",
+	r := &archmirror.MirrorListConfig{
+		Protocols:  []archmirror.ProtocolType{},
+		IPVersions: []archmirror.IPVersion{},
+		Countries:  []string{},
+	}
+
+	if err := parseFlags(flag.CommandLine, args); err != nil {
+		return err
+	}
+	if *showVersion {
+		fmt.Println(version.String())
+		return nil
+	}
+	s, cleanup, err := setup(flag.CommandLine)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	ctx, client := s.ctx, s.client
+
+	if *clearFailureCache {
+		path, err := archmirror.DefaultFailureCachePath()
+		if err == nil {
+			err = archmirror.ClearFailureCache(path)
+		}
+		if err != nil {
+			return filesystemError("Failed clearing the failure cache: %w", err)
+		}
+	}
+
+	if *listCountries {
+		if err := printCountries(ctx, client, *jsonOutput); err != nil {
+			return networkError("Failed requesting the country list: %w", err)
+		}
+		return nil
+	}
+
+	flavor, err := archmirror.GetFlavor(*flavorName)
+	if err != nil {
+		return usageError("Invalid flavor: %w", err)
+	}
+	_, isArch := flavor.(archmirror.ArchFlavor)
+	if _, ok := flavor.(archmirror.ManjaroFlavor); ok {
+		b, err := archmirror.ParseManjaroBranch(*branch)
+		if err != nil {
+			return usageError("Invalid branch: %w", err)
+		}
+		flavor = archmirror.ManjaroFlavor{Branch: b}
+	} else if isFlagSet("branch") {
+		return usageError("-branch only applies to -flavor manjaro!")
+	}
+	arch, err := probeArch(flavor)
+	if err != nil {
+		return err
 	}
 
-	flag.Parse()
+	r.KeepCommented = !*uncomment
+	// Other flavors have their own default source
+	if _, ok := optionSources["url"]; ok || isArch {
+		r.BaseURL = *generatorURL
+	}
+	if !*noCache {
+		r.Cache = openResponseCache()
+	}
 
 	// IP Version
 	if *IPv4 {
-		r.IPVersions = append(r.IPVersions, IPVersion4)
+		r.IPVersions = append(r.IPVersions, archmirror.IPVersion4)
 	}
 	if *IPv6 {
-		r.IPVersions = append(r.IPVersions, IPVersion6)
+		r.IPVersions = append(r.IPVersions, archmirror.IPVersion6)
 	}
 
 	// Protocols
 	if *useHTTP {
-		r.Protocols = append(r.Protocols, ProtocolTypeHTTP)
+		r.Protocols = append(r.Protocols, archmirror.ProtocolTypeHTTP)
 	}
 	if *useHTTPS {
-		r.Protocols = append(r.Protocols, ProtocolTypeHTTPS)
+		r.Protocols = append(r.Protocols, archmirror.ProtocolTypeHTTPS)
+	}
+	if len(protocolNames) > 0 {
+		r.Protocols = []archmirror.ProtocolType{}
+		for _, name := range protocolNames {
+			p, err := archmirror.ParseProtocol(name)
+			if err != nil {
+				return usageError("Invalid protocol: %w", err)
+			}
+			r.Protocols = append(r.Protocols, p)
+		}
 	}
 
-	// The CountryCode
-	r.Country = *CountryCode
+	// The countries
+	r.Countries = countryNames
+	if *allCountries {
+		r.Countries = []string{archmirror.CountryAll}
+	}
 
 	// Check if we have all we need
 	if len(r.Protocols) == 0 {
-		fmt.Println("No protocol(s) specified!")
-		os.Exit(1)
+		return usageError("No protocol(s) specified!")
 	}
 	if len(r.IPVersions) == 0 {
-		fmt.Println("No IP version(s) specified!")
-		os.Exit(1)
+		return usageError("No IP version(s) specified!")
+	}
+	if len(r.Countries) == 0 && *inputFile == "" {
+		return usageError("No county specified!")
 	}
-	if r.Country == "" {
-		fmt.Println("No county specified!")
-		os.Exit(1)
+	if *inputFile != "" && r.UsesRsync() {
+		return usageError("-in cannot be used with rsync mirrors!")
+	}
+	if *inputFile == "-" && isTerminal(os.Stdin) {
+		return usageError("-in - reads the mirrorlist from standard input, pipe one in, e.g. curl ... | archmirror -in -")
+	}
+	if *toStdout {
+		*outputFile = "-"
+	}
+	if *interactive && (*daemon || *outputFile == "-" || !isTerminal(os.Stdin) || !isTerminal(os.Stdout)) {
+		return usageError("-interactive needs a terminal and an output file!")
+	}
+	if *inputFile == "-" && *daemon {
+		return usageError("-daemon cannot read the mirrorlist from standard input!")
 	}
 	if *outputFile == "" {
-		fmt.Println("No output file specified!")
-		os.Exit(1)
+		return usageError("No output file specified!")
+	}
+	if *limit < 0 || (*limit == 0 && isFlagSet("n")) {
+		return usageError("The number of mirrors must be a positive integer!")
+	}
+	rank, err := archmirror.ParseRankMode(*rankMode)
+	if err != nil {
+		return usageError("Invalid ranking mode: %w", err)
+	}
+	sortKeys, err := archmirror.ParseSortKeys(*sortKey)
+	if err != nil {
+		return usageError("Invalid -sort: %w", err)
+	}
+	sortByStatus := false
+	for _, k := range sortKeys {
+		// Measure what the mirrors are sorted by
+		if mode := k.RankMode(); mode != archmirror.RankNone && rank == archmirror.RankNone {
+			rank = mode
+		} else if mode != archmirror.RankNone && mode != rank {
+			return usageError("-sort %s needs -rank %s, but the mirrors are ranked by %s", k, mode, rank)
+		}
+		// The lastsync files are as good as the status
+		if k.NeedsStatus() && !(k == archmirror.SortAge && *verifySync) {
+			sortByStatus = true
+		}
+	}
+	if *testFile != "" && rank != archmirror.RankRate {
+		return usageError("-test-file is only downloaded with -rank rate!")
+	}
+	if *probeSamples < 1 {
+		return usageError("-samples must be at least 1!")
+	}
+	if (*requireIPv4 || *requireIPv6) && rank == archmirror.RankNone {
+		return usageError("-require-ipv4-reachable and -require-ipv6-reachable are checked by the probes, use -rank!")
+	}
+	if *probeWarmup && rank == archmirror.RankNone {
+		return usageError("-warmup only applies when ranking with -rank!")
+	}
+	if *probeSamples > 1 && rank != archmirror.RankLatency {
+		return usageError("-samples only applies to -rank latency!")
+	}
+	if (isFlagSet("probe-max-bytes") || isFlagSet("probe-max-total")) && rank != archmirror.RankRate {
+		return usageError("-probe-max-bytes and -probe-max-total only limit -rank rate!")
 	}
+	if probeMaxBytes <= 0 {
+		return usageError("-probe-max-bytes must be greater than zero!")
+	}
+	if probeMaxTotal > 0 && probeMaxTotal < probeMaxBytes {
+		return usageError("-probe-max-total must be at least -probe-max-bytes (%s)", &probeMaxBytes)
+	}
+	if strings.Contains(*testFile, "$repo") {
+		return usageError("-test-file names the repository itself, only $arch is replaced")
+	}
+	// The filters that need the mirror status
+	if *completion < 0 || *completion > 100 {
+		return usageError("The completion percentage must be between 0 and 100!")
+	}
+	if *maxAge < 0 {
+		return usageError("The age must not be negative!")
+	}
+	if *maxDelay < 0 {
+		return usageError("The delay must not be negative!")
+	}
+	if *tier < -1 {
+		return usageError("Invalid tier!")
+	}
+	filterByStatus := *completion > 0 || *maxAge > 0 || *maxDelay > 0 || *tier >= 0
 
-	// Fetch the Mirrorlist
-	ret, err := RequestMirrorList(r)
+	var includes []string
+	if *includeFrom != "" {
+		includes, err = archmirror.ReadIncludeList(*includeFrom)
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			return filesystemError("Failed reading the include list: %w", err)
+		} else if err != nil {
+			return usageError("Invalid include list: %w", err)
+		}
+		if len(includes) == 0 {
+			return usageError("The include list %s is empty!", *includeFrom)
+		}
+	}
+	if *outputFormat == "pacman" && r.UsesRsync() {
+		return usageError("pacman cannot use rsync mirrors, choose a different -output-format!")
+	}
+	if *verifySync && rank == archmirror.RankNone {
+		return usageError("-verify-sync needs -rank!")
+	}
+	if *maxSyncAge < 0 {
+		return usageError("The sync age must not be negative!")
+	}
+	if *maxLag < 0 {
+		return usageError("The lag must not be negative!")
+	}
+	if *maxLag > 0 && rank == archmirror.RankNone {
+		return usageError("-max-lag needs -rank!")
+	}
+	if rank != archmirror.RankNone && r.UsesRsync() {
+		return usageError("rsync mirrors cannot be ranked!")
+	}
+	if *minMirrors < 0 {
+		return usageError("The minimum number of mirrors must not be negative!")
+	}
+	if *activateTop < 0 {
+		return usageError("The number of active mirrors must not be negative!")
+	}
+	if *activateTop > 0 && *limit > 0 {
+		return usageError("-activate-top and -n cannot be used together!")
+	}
+	if *cacheTTL < 0 {
+		return usageError("The cache TTL must not be negative!")
+	}
+	if *retries < 0 {
+		return usageError("The number of retries must not be negative!")
+	}
+	if *timeout < 0 {
+		return usageError("The timeout must not be negative!")
+	}
+	if *probeThreads < 1 {
+		return usageError("The number of threads must be a positive integer!")
+	}
+	format, err := archmirror.GetOutputFormat(*outputFormat)
 	if err != nil {
-		fmt.Printf("Failed requesting the mirrorlist: %v\n", err)
-		os.Exit(1)
+		return usageError("Invalid output format: %w", err)
+	}
+	if !slices.Contains(summaryFormats, *summaryFormat) {
+		return usageError("Invalid summary format %q, use one of %s", *summaryFormat, strings.Join(summaryFormats, ", "))
+	}
+	if !isArch && *maxLag > 0 {
+		return usageError("-max-lag is only available for -flavor arch!")
+	}
+	// archlinux.org only knows about its own mirrors
+	if !isArch && (*useStatus || sortByStatus || filterByStatus || r.UsesRsync()) {
+		return usageError("The mirror status and rsync mirrors are only available for -flavor arch!")
+	}
+
+	if !*noValidate {
+		if err := r.Validate(); err != nil {
+			return usageError("Invalid configuration: %w", err)
+		}
+	}
+
+	if *daemon && *outputFile == "-" {
+		return usageError("-daemon needs an output file!")
+	}
+	if *daemon && *dryRun {
+		return usageError("-daemon and -dry-run cannot be used together!")
+	}
+	if *desktopNotify && !*daemon {
+		return usageError("-notify only works with -daemon!")
+	}
+	if *interval <= 0 {
+		return usageError("The interval must be positive!")
+	}
+
+	// Find out about missing permissions before all the network work
+	if *outputFile != "-" && !*dryRun {
+		if err := archmirror.CheckWritable(*outputFile); err != nil {
+			if errors.Is(err, fs.ErrPermission) {
+				return filesystemError("Cannot write the mirrorlist: %w\nRun archmirror with sudo or choose a different -out path", err)
+			}
+			return filesystemError("Cannot write the mirrorlist: %w", err)
+		}
+	}
+
+	j := &fetchJob{
+		flavor:         flavor,
+		arch:           arch,
+		config:         r,
+		format:         format,
+		rank:           rank,
+		includes:       includes,
+		filterByStatus: filterByStatus,
+		sortKeys:       sortKeys,
+		sortByStatus:   sortByStatus,
+	}
+	if *daemon {
+		runDaemon(ctx, s, j)
+		return nil
+	}
+
+	_, err = refresh(ctx, s, j)
+	return err
+}
+
+// The names of the sort keys, of all of them if none are given
+func sortKeyNames(keys ...archmirror.SortKey) []string {
+	if len(keys) == 0 {
+		keys = archmirror.SortKeys
+	}
+	names := make([]string, 0, len(keys))
+	for _, k := range keys {
+		names = append(names, string(k))
+	}
+
+	return names
+}
+
+// The architecture the probes download the databases of: -arch, or the one
+// of this machine if the mirrors of the flavor have it
+func probeArch(f archmirror.Flavor) (string, error) {
+	arches := f.Arches()
+	if *archName == "" {
+		if host := archmirror.NormalizeArch(hostMachine()); slices.Contains(arches, host) {
+			return host, nil
+		}
+		return arches[0], nil
+	}
+
+	arch := archmirror.NormalizeArch(*archName)
+	if !slices.Contains(archmirror.KnownArches, arch) && !*unknownArch {
+		return "", usageError("Unknown architecture %q, use one of %s or -allow-unknown-arch", *archName, strings.Join(archmirror.KnownArches, ", "))
+	}
+	if !slices.Contains(arches, arch) {
+		slog.Warn(fmt.Sprintf("The mirrors of %s usually do not have %s, only %s", f.Name(), arch, strings.Join(arches, ", ")))
+	}
+
+	return arch, nil
+}
+
+// What a refresh needs that was worked out from the flags
+type fetchJob struct {
+	flavor         archmirror.Flavor
+	arch           string
+	config         *archmirror.MirrorListConfig
+	format         archmirror.OutputFormat
+	rank           archmirror.RankMode
+	includes       []string
+	filterByStatus bool
+	sortKeys       []archmirror.SortKey
+	// Sorting needs the mirror status
+	sortByStatus bool
+}
+
+// Refresh the mirrorlist every -interval until ctx is cancelled. The first
+// refresh happens right away. A failed refresh is only logged, the next one
+// may work again. When run by systemd, it is told once the first refresh
+// worked and about the result of each one.
+func runDaemon(ctx context.Context, s *session, j *fetchJob) {
+	defer notify(sdnotify.Stopping)
+
+	// Tell systemd we are still alive, independent of how long a refresh takes
+	if every := sdnotify.WatchdogInterval(); every > 0 {
+		go func() {
+			ticker := time.NewTicker(every)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					notify(sdnotify.Watchdog)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	ready := false
+	// Failed refreshes since the last one that worked
+	failures := 0
+	for {
+		// The deadline applies to each refresh on its own
+		iteration, cancel := ctx, context.CancelFunc(func() {})
+		if *deadline > 0 {
+			iteration, cancel = context.WithTimeout(ctx, *deadline)
+		}
+		sum, err := refresh(iteration, s, j)
+		cancel()
+		if ctx.Err() != nil {
+			slog.Info("Stopping")
+			return
+		}
+
+		// Up to a tenth of the interval on top keeps machines that were
+		// started together from all asking archlinux.org at the same time
+		wait := *interval + rand.N(*interval/10+1)
+		next := time.Now().Add(wait).Format(time.DateTime)
+		if err != nil {
+			slog.Error("Refreshing the mirrorlist failed", "error", err)
+			notify(sdnotify.Status(fmt.Sprintf("The last refresh failed: %v, next refresh at %s", err, next)))
+			failures++
+			if failures == failedRefreshesNotify {
+				notifyDesktop(ctx, desktop.Critical, "Refreshing the mirrorlist keeps failing", fmt.Sprintf("%d refreshes in a row failed: %v", failures, err))
+			}
+		} else {
+			failures = 0
+			if sum.Outcome == outcomeWritten && sum.Changed {
+				notifyDesktop(ctx, desktop.Normal, "Mirrorlist updated", updatedMessage(sum))
+			}
+			if !ready {
+				notify(sdnotify.Ready)
+				ready = true
+			}
+			notify(sdnotify.Status(fmt.Sprintf("Refreshed %s, next refresh at %s", *outputFile, next)))
+		}
+
+		slog.Info("Waiting for the next refresh", "wait", wait.Round(time.Second))
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			slog.Info("Stopping")
+			return
+		}
+	}
+}
+
+// Tell systemd about our state, if it is listening
+func notify(state string) {
+	if err := sdnotify.Notify(state); err != nil {
+		slog.Debug("Failed notifying systemd", "state", state, "error", err)
 	}
+}
 
-	// Open the file
-	// - O_APPEND: We write the lines one after another
-	// - O_CREATE: If the file does not exist, we want to create it
-	// - O_EXCL: We don't want the file to already exist
-	// - O_WRONLY: We only want to write to the file
-	file, err := os.OpenFile(*outputFile, os.O_APPEND|os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+// Fetch, filter, rank and write the mirrorlist once and tell how it went
+func refresh(ctx context.Context, s *session, j *fetchJob) (*runSummary, error) {
+	sum := newRunSummary(j)
+	var err error
+	// Only one run at a time may write the file
+	if *outputFile != "-" && !*dryRun {
+		var unlock func()
+		unlock, err = lockFile(ctx, lockPath(), *lockTimeout)
+		if errors.Is(err, errLocked) {
+			err = &exitError{exitLocked, err}
+		} else if err != nil {
+			err = filesystemError("Failed locking %s: %w", lockPath(), err)
+		} else {
+			defer unlock()
+		}
+	}
+	if err == nil {
+		err = update(ctx, s, j, sum)
+	}
+	sum.Finished = time.Now()
 	if err != nil {
-		fmt.Printf("Failed to open file: %v\n", err)
-		os.Exit(1)
+		sum.Error = err.Error()
+	}
+
+	switch *summaryFormat {
+	case "text":
+		if err == nil {
+			logSummary(sum)
+		}
+	case "json":
+		// Asked for explicitly, so -quiet does not hide it
+		if werr := sum.writeJSON(stderr); werr != nil {
+			slog.Warn("Failed printing the summary", "error", werr)
+		}
+	}
+	if *summaryJSON != "" {
+		var buf bytes.Buffer
+		werr := sum.writeJSON(&buf)
+		if werr == nil {
+			werr = archmirror.WriteFileAtomic(*summaryJSON, buf.Bytes(), true)
+		}
+		if werr != nil && err == nil {
+			return sum, filesystemError("Failed writing the summary: %w", werr)
+		} else if werr != nil {
+			slog.Warn("Failed writing the summary", "path", *summaryJSON, "error", werr)
+		}
 	}
 
-	// In case we fail we still want the file to be closed
-	defer file.Close()
+	return sum, err
+}
+
+// The steps of a refresh, recording what happened in sum
+func update(ctx context.Context, s *session, j *fetchJob, sum *runSummary) error {
+	client, probeClient := s.client, s.probeClient
+	r, format, rank, includes, filterByStatus := j.config, j.format, j.rank, j.includes, j.filterByStatus
+	// A daemon replaces the file it wrote last time
+	overwrite := *force || *daemon
+
+	// Fetch the Mirrorlist
+	ret := &archmirror.Mirrorlist{Generated: time.Now()}
+	// The commented out mirrors of -in that are written back as they are
+	var asIs []archmirror.Mirror
+	if *inputFile == "-" {
+		var err error
+		ret, err = archmirror.ParseMirrorlistOrURLs(os.Stdin)
+		if err != nil {
+			return invalidError("Failed reading the mirrorlist from standard input: %w", err)
+		}
+		sum.Source = "standard input"
+	} else if *inputFile != "" {
+		var err error
+		ret, err = archmirror.ReadMirrorlistFile(*inputFile)
+		if err != nil {
+			return filesystemError("Failed reading the mirrorlist: %w", err)
+		}
+		sum.Source = *inputFile
+	}
+	if *inputFile != "" {
+		ret.Generated = time.Now()
+		mirrors := make([]archmirror.Mirror, 0, len(ret.Mirrors))
+		for _, m := range ret.Mirrors {
+			if m.Active {
+				mirrors = append(mirrors, m)
+			} else if *inputCommented {
+				m.Active = true
+				mirrors = append(mirrors, m)
+			} else {
+				asIs = append(asIs, m)
+			}
+		}
+		ret.Mirrors = mirrors
+		if len(ret.Mirrors) == 0 {
+			return invalidError("%s does not contain any active mirrors, use -in-commented to use the commented ones", *inputFile)
+		}
+	} else if r.UsesGenerator() {
+		onRetry := func(attempt int, err error, wait time.Duration) {
+			slog.Debug("Request failed, retrying", "attempt", attempt, "error", err, "wait", wait.Round(time.Millisecond))
+		}
+		request := func(ctx context.Context, c *archmirror.MirrorListConfig) (*archmirror.Mirrorlist, error) {
+			var list *archmirror.Mirrorlist
+			err := archmirror.Retry(ctx, *retries, onRetry, func() error {
+				var err error
+				list, err = j.flavor.RequestMirrorList(ctx, client, c)
+				return err
+			})
+			return list, err
+		}
+		// The generator is asked for each country at the same time, the
+		// other flavors filter a single list anyway
+		if _, ok := j.flavor.(archmirror.ArchFlavor); ok && r.SplitsByCountry() {
+			var failed []*archmirror.CountryError
+			ret, failed = archmirror.RequestEachCountry(ctx, r, archmirror.DefaultCountryThreads, *strict, request)
+			errs := make([]error, 0, len(failed))
+			for _, f := range failed {
+				slog.Warn("Failed requesting the mirrors of a country", "country", f.Country, "error", f.Err)
+				errs = append(errs, f)
+			}
+			if ret == nil || (*strict && len(errs) > 0) {
+				return networkError("Failed requesting the mirrorlist: %w", errors.Join(errs...))
+			}
+		} else {
+			var err error
+			ret, err = request(ctx, r)
+			if err != nil {
+				return networkError("Failed requesting the mirrorlist: %w", err)
+			}
+		}
+		if ret.FromCache {
+			slog.Info("Using the cached mirrorlist", "fetched", ret.Generated.Format(time.DateTime))
+		}
+		sum.Source, _ = j.flavor.Source(r)
+		if ret.FromCache {
+			sum.Source = "the cache"
+		}
+	}
 
-	// Append all lines
-	for _, line := range *ret {
-		_, err := file.WriteString(line)
+	// Join what archlinux.org knows about the mirrors
+	var report *archmirror.StatusReport
+	if *useStatus || j.sortByStatus || filterByStatus || r.UsesRsync() {
+		var err error
+		report, err = archmirror.RequestMirrorStatusContext(ctx, client)
 		if err != nil {
-			fmt.Printf("Failed writing mirrorlist: %v\n", err)
-			os.Exit(1)
+			return networkError("Failed requesting the mirror status: %w", err)
 		}
+		if r.UsesRsync() {
+			rsync, err := report.RsyncMirrors(r)
+			if err != nil {
+				return invalidError("Failed selecting the rsync mirrors: %w", err)
+			}
+			if len(rsync) == 0 {
+				return invalidError("No rsync mirror found!")
+			}
+			ret.Mirrors = append(ret.Mirrors, rsync...)
+			if sum.Source == "" {
+				sum.Source = "the mirror status"
+			}
+		}
+		found := report.Attach(ret)
+		slog.Debug(fmt.Sprintf("Found the status of %d of %d mirrors", found, len(ret.Mirrors)))
 	}
+
+	sum.Fetched = len(ret.Mirrors)
+	// -merge has to know every mirror we could have written, not only the
+	// ones that pass the filters
+	fetched := &archmirror.Mirrorlist{Mirrors: slices.Clone(ret.Mirrors)}
+
+	// Describe what we are about to write
+	describeConfig(ret, j.flavor, r)
+
+	// Remove the mirrors we don't want
+	filters := make([]archmirror.Filter, 0)
+	if includes != nil {
+		include := archmirror.IncludeFilter(includes)
+		matched := false
+		for i := range ret.Mirrors {
+			matched = matched || include.Keep(&ret.Mirrors[i])
+		}
+		if !matched {
+			return invalidError("None of the entries in %s match a fetched mirror!", *includeFrom)
+		}
+		filters = append(filters, include)
+	}
+	excludeFilter := -1
+	if len(excludes) > 0 {
+		excludeFilter = len(filters)
+		filters = append(filters, archmirror.ExcludeFilter(excludes))
+	}
+	filters = append(filters, statusFilters(ctx, client, report)...)
+	excluded := make([]archmirror.Mirror, 0)
+	if len(filters) > 0 {
+		left := len(ret.Mirrors)
+		for i, result := range archmirror.ApplyFilters(ret, filters) {
+			if i == excludeFilter {
+				excluded = result.Removed
+			}
+			slog.Info(fmt.Sprintf("Filter %s removed %d mirrors", result.Filter.Description, len(result.Removed)))
+			left -= len(result.Removed)
+			sum.step("Filter "+result.Filter.Description, len(result.Removed), left)
+			if result.Filter.Detail != nil && slog.Default().Enabled(ctx, slog.LevelDebug) {
+				for _, m := range result.Removed {
+					slog.Debug("Removed", "mirror", m.URL, "reason", result.Filter.Detail(&m))
+				}
+			}
+			ret.AddHeaderNote("Filtered by " + result.Filter.Description)
+		}
+		// Lookups that were aborted look like mirrors that failed a filter
+		if err := ctx.Err(); err != nil {
+			return networkError("Filtering was aborted: %w", err)
+		}
+		if len(ret.Mirrors) == 0 {
+			return invalidError("No mirror passed the filters!")
+		}
+	}
+
+	// Spread the load across the mirrors
+	if *shuffle {
+		ret.Shuffle()
+		sum.Order = "shuffle"
+	}
+
+	// Measure the mirrors
+	if rank != archmirror.RankNone {
+		// Skip the mirrors that failed recently
+		failures := loadFailureCache()
+		if failures != nil {
+			mirrors := make([]archmirror.Mirror, 0, len(ret.Mirrors))
+			for _, m := range ret.Mirrors {
+				if failures.Failed(&m) {
+					slog.Debug("Skipping a mirror that failed recently", "mirror", m.URL)
+					continue
+				}
+				mirrors = append(mirrors, m)
+			}
+			sum.step("The failure cache", len(ret.Mirrors)-len(mirrors), len(mirrors))
+			ret.Mirrors = mirrors
+		}
+
+		// Without the master there is only what each mirror says about itself
+		checkSync, syncAge := *verifySync, *maxSyncAge
+		var master time.Time
+		if *maxLag > 0 {
+			var err error
+			master, err = archmirror.RequestMasterLastUpdate(ctx, client, archmirror.MasterLastUpdateURL)
+			if err != nil {
+				slog.Warn("Failed requesting the lastupdate of the master mirror, checking the lastsync of each mirror instead", "error", err)
+				if !checkSync {
+					checkSync, syncAge = true, *maxLag
+				}
+			} else {
+				slog.Debug("The master mirror was last updated", "time", master.Format(time.DateTime))
+			}
+		}
+
+		target := j.flavor.ProbeTarget()
+		target.Arch = j.arch
+		target.LargePath = *testFile
+		ret.AddHeaderNote("Ranked with the " + j.arch + " databases")
+		if *testFile != "" {
+			ret.AddHeaderNote("Rate measured with " + *testFile)
+		}
+		if rank == archmirror.RankRate && probeMaxTotal > 0 {
+			ret.AddHeaderNote(fmt.Sprintf("Rate measured with %s of each mirror, at most %s in total", &probeMaxBytes, &probeMaxTotal))
+		} else if rank == archmirror.RankRate && isFlagSet("probe-max-bytes") {
+			ret.AddHeaderNote(fmt.Sprintf("Rate measured with %s of each mirror", &probeMaxBytes))
+		}
+		summary := archmirror.Rank(ctx, ret, archmirror.RankOptions{
+			Mode:    rank,
+			Timeout: time.Duration(probeTimeout),
+			Threads: *probeThreads,
+			Client:  probeClient,
+			Target:  target,
+
+			Warmup:        *probeWarmup,
+			Samples:       *probeSamples,
+			MaxBytes:      int64(probeMaxBytes),
+			MaxTotalBytes: int64(probeMaxTotal),
+
+			VerifySync:      checkSync,
+			MaxSyncAge:      syncAge,
+			KeepUnknownSync: *keepUnknownSync,
+			MaxLag:          *maxLag,
+			MasterUpdate:    master,
+			Progress:        probeProgress(),
+		})
+		stderr.Clear()
+		probeClient.CloseIdleConnections()
+		ret.AddHeaderNote(fmt.Sprintf("Ranked by %s with a probe timeout of %s", rank, time.Duration(probeTimeout)))
+		if *probeWarmup {
+			ret.AddHeaderNote("Measured over warm connections")
+			slog.Debug(fmt.Sprintf("%d of %d measured mirrors were probed over a warm connection", summary.Reused, summary.Reachable))
+		}
+		if *probeSamples > 1 {
+			ret.AddHeaderNote(fmt.Sprintf("Latency is the median of %d samples", *probeSamples))
+		}
+		if v, ok := probeIPVersion(); ok {
+			ret.AddHeaderNote("Only mirrors reachable over IPv" + v.String())
+		}
+		if checkSync {
+			ret.AddHeaderNote(fmt.Sprintf("Only mirrors that synced within %s", syncAge))
+		}
+		if !master.IsZero() {
+			ret.AddHeaderNote(fmt.Sprintf("Only mirrors at most %s behind the master mirror", *maxLag))
+		}
+		if *verbose && rank == archmirror.RankRate {
+			printRateTable(summary)
+		}
+		if *verbose && *probeSamples > 1 {
+			printLatencyTable(summary)
+		}
+		for _, f := range summary.Failed() {
+			slog.Info("Dropping", "mirror", f.Mirror.URL, "error", f.Err)
+		}
+		for _, f := range summary.MissingTestFile() {
+			slog.Info("Keeping unmeasured", "mirror", f.Mirror.URL, "error", f.Err)
+		}
+		slog.Info(summary.String())
+		sum.step("Ranking", len(summary.Failed()), len(ret.Mirrors))
+		sum.Probed, sum.Failed, sum.Bytes = summary.Tested, len(summary.Failed()), summary.Bytes
+		sum.probes(summary)
+		sum.Order = string(rank)
+		// A mirror without IPv6 is still good for everyone else
+		if _, ok := probeIPVersion(); failures != nil && !ok {
+			failures.Record(summary.Results, time.Now())
+			if err := failures.Save(); err != nil {
+				slog.Warn("Failed saving the failure cache", "error", err)
+			}
+		}
+		if err := ctx.Err(); err != nil && !*writePartial {
+			return networkError("Ranking was aborted (%w), not writing the mirrorlist", err)
+		}
+		if summary.Reachable == 0 && summary.Missing > 0 {
+			return invalidError("No mirror has the test file, check -test-file!")
+		}
+		if summary.Reachable == 0 {
+			return networkError("No mirror is reachable!")
+		}
+	}
+
+	// Sort by what we and archlinux.org measured
+	if len(j.sortKeys) > 0 {
+		if slices.Contains(j.sortKeys, archmirror.SortScore) && *dropUnscored {
+			dropped := archmirror.SortByScore(ret, true)
+			if dropped > 0 {
+				slog.Debug(fmt.Sprintf("Removed %d mirrors without a score", dropped))
+				sum.step("-drop-unscored", dropped, len(ret.Mirrors))
+			}
+			if len(ret.Mirrors) == 0 {
+				return invalidError("No mirror has a score!")
+			}
+		}
+		archmirror.SortMirrors(ret, j.sortKeys)
+		order := sortKeyNames(j.sortKeys...)
+		ret.AddHeaderNote("Sorted by " + strings.Join(order, ", "))
+		sum.Order = strings.Join(order, ",")
+	}
+
+	// Let the user pick
+	if *interactive {
+		selected, err := promptSelection(os.Stdin, os.Stdout, ret)
+		if err != nil {
+			return usageError("Failed reading the selection: %w", err)
+		}
+		removed := len(ret.Mirrors) - len(selected)
+		ret.Select(selected)
+		sum.step("-interactive", removed, len(ret.Mirrors))
+		sum.Order = "hand"
+		ret.AddHeaderNote("Selected by hand")
+	}
+
+	// Limit the number of mirrors
+	if *limit > 0 {
+		if len(ret.Mirrors) < *limit {
+			slog.Info(fmt.Sprintf("Only %d of the requested %d mirrors are available", len(ret.Mirrors), *limit))
+		}
+		before := len(ret.Mirrors)
+		ret.Truncate(*limit)
+		sum.step(fmt.Sprintf("-n %d", *limit), before-len(ret.Mirrors), len(ret.Mirrors))
+		ret.AddHeaderNote(fmt.Sprintf("Limited to %d mirrors", *limit))
+	}
+
+	// Keep the slower mirrors around for manual use
+	if *activateTop > 0 {
+		ret.ActivateTop(*activateTop)
+		sum.step(fmt.Sprintf("-activate-top %d (commenting out)", *activateTop), max(len(ret.Mirrors)-*activateTop, 0), min(len(ret.Mirrors), *activateTop))
+		ret.AddHeaderNote(fmt.Sprintf("Only the first %d mirrors are active", *activateTop))
+	}
+
+	// One heading per country instead of one whenever the country changes.
+	// The fallback mirrors stay in their own section at the end.
+	if *groupByCountry {
+		ret.GroupByCountry()
+		ret.AddHeaderNote("Grouped by country")
+	}
+
+	// Keep the excluded mirrors around for manual use
+	if *keepExcluded {
+		for _, m := range excluded {
+			m.Active = false
+			ret.Mirrors = append(ret.Mirrors, m)
+		}
+	}
+	ret.Mirrors = append(ret.Mirrors, asIs...)
+
+	// Keep the mirrors that were added by hand
+	if *merge && *outputFile != "-" {
+		old, err := archmirror.ReadMirrorlistFile(*outputFile)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return filesystemError("Failed reading the old mirrorlist: %w", err)
+		}
+		if old != nil {
+			kept := ret.Merge(old, fetched)
+			slog.Debug(fmt.Sprintf("Kept %d mirrors of the old mirrorlist", kept))
+		}
+		ret.AddHeaderNote("Server lines between \"" + archmirror.KeepMarker + "\" and \"" + archmirror.KeepEndMarker + "\" are kept by -merge")
+	}
+
+	// Merging and several countries can list a mirror twice
+	if removed := ret.RemoveDuplicates(); removed > 0 {
+		slog.Debug(fmt.Sprintf("Removed %d duplicate mirrors", removed))
+	}
+
+	// Rather fail than leave pacman with one flaky mirror. With -uncomment=false
+	// the user picks the mirrors from the commented out ones.
+	if err := ret.RequireMirrors(*minMirrors); err != nil && !r.KeepCommented {
+		if len(sum.Steps) == 0 {
+			return invalidError("%w", err)
+		}
+		return invalidError("%w:\n  %s", err, strings.Join(sum.removals(), "\n  "))
+	}
+
+	// Leave out everything that changes between runs
+	if *noHeader {
+		ret.Notes = nil
+	}
+
+	// Render the whole mirrorlist before touching the output so that a
+	// failure can never leave a partially written file behind
+	var buf bytes.Buffer
+	if err := format(&buf, ret, r); err != nil {
+		return invalidError("Failed rendering mirrorlist: %w", err)
+	}
+	if *outputFormat == "pacman" {
+		if err := checkServerLines(buf.Bytes(), j, sum.Source); err != nil {
+			return err
+		}
+	}
+
+	// Compare with what we are about to replace
+	if *showDiff && *outputFile != "-" {
+		old, err := archmirror.ReadMirrorlistFile(*outputFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			slog.Info("There is no mirrorlist to compare with yet", "path", *outputFile)
+		} else if err != nil {
+			return filesystemError("Failed reading the old mirrorlist: %w", err)
+		} else if diff := archmirror.DiffMirrorlists(old, ret); diff.Empty() {
+			slog.Info("No changes", "path", *outputFile)
+		} else {
+			diff.Write(os.Stderr, *outputFile, *outputFile+" (new)")
+		}
+	}
+
+	// Only show what we would do
+	if *dryRun {
+		printDryRun(ret, j.flavor, r)
+		sum.finish(outcomeDryRun, ret)
+		return nil
+	}
+
+	// Write to standard output
+	if *outputFile == "-" {
+		if _, err := os.Stdout.Write(buf.Bytes()); err != nil {
+			return filesystemError("Failed writing mirrorlist: %w", err)
+		}
+		sum.finish(outcomeStdout, ret)
+		return nil
+	}
+
+	// Leave the file and its modification time alone if only the header
+	// would change
+	sum.Changed = !unchanged(buf.Bytes())
+	if !*forceWrite && !sum.Changed {
+		slog.Info("Mirrorlist up to date", "path", *outputFile)
+		sum.finish(outcomeUnchanged, ret)
+		return nil
+	}
+
+	// Someone at a terminal gets to look at the new list first, hooks and
+	// scripts never block here
+	if overwrite && !*assumeYes && !*daemon && isTerminal(os.Stdin) && fileExists(*outputFile) {
+		ok, err := confirmReplace(ret)
+		if err != nil {
+			return usageError("Failed reading the answer: %w", err)
+		}
+		if !ok {
+			return &exitError{exitInterrupted, errors.New("Not replacing the mirrorlist")}
+		}
+	}
+
+	// Keep a copy of the file that is about to be replaced
+	if *backup && !*noBackup && overwrite {
+		path, err := archmirror.BackupFile(*outputFile, time.Now())
+		if err != nil {
+			return filesystemError("Failed backing up mirrorlist: %w", err)
+		}
+		if path != "" {
+			slog.Info("Backed up the old mirrorlist", "path", path)
+		}
+	}
+
+	// Atomically write the file
+	if err := archmirror.WriteFileAtomic(*outputFile, buf.Bytes(), overwrite); err != nil {
+		return filesystemError("Failed writing mirrorlist: %w", err)
+	}
+	slog.Debug(fmt.Sprintf("Wrote %d mirrors", len(ret.Mirrors)), "path", *outputFile)
+
+	// Get rid of old backups
+	if *backup && !*noBackup && *backupKeep >= 0 {
+		removed, err := archmirror.PruneBackups(*outputFile, *backupKeep)
+		for _, path := range removed {
+			slog.Debug("Removed an old backup", "path", path)
+		}
+		if err != nil {
+			return filesystemError("Failed removing old backups: %w", err)
+		}
+	}
+
+	sum.finish(outcomeWritten, ret)
+
+	// Let the user do something with the new file, e.g. pacman -Syy
+	if *execHook != "" {
+		if err := runHook(ctx, *execHook, sum); err != nil {
+			if *execRequired {
+				return &exitError{exitHook, fmt.Errorf("The -exec command failed: %w", err)}
+			}
+			slog.Warn("The -exec command failed", "error", err)
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/PapaTutuWawa/archmirror/internal/style"
+)
+
+// Standard error with an optional status line at the bottom that other
+// output is written above
+type statusWriter struct {
+	mu   sync.Mutex
+	w    io.Writer
+	line string
+}
+
+// All messages go through here so they do not garble the progress
+var stderr = &statusWriter{w: os.Stderr}
+
+// How messages on stderr are styled, worked out from -color once the flags
+// are known. Errors in the flags themselves are colored if stderr looks
+// like it can take it.
+var colors = style.New(os.Getenv("NO_COLOR") == "" && isTerminal(os.Stderr))
+
+// Erase the current line of the terminal
+const clearLine = "\r\033[K"
+
+func (s *statusWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.line == "" {
+		return s.w.Write(p)
+	}
+
+	io.WriteString(s.w, clearLine)
+	n, err := s.w.Write(p)
+	io.WriteString(s.w, s.line)
+	return n, err
+}
+
+// Replace the status line
+func (s *statusWriter) SetStatus(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.line = line
+	io.WriteString(s.w, clearLine+line)
+}
+
+// Remove the status line
+func (s *statusWriter) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.line != "" {
+		io.WriteString(s.w, clearLine)
+		s.line = ""
+	}
+}
+
+// How often the progress is logged when stderr is not a terminal
+const progressLogInterval = 10 * time.Second
+
+// Report the progress of the probes, in place on a terminal and as an
+// occasional message otherwise
+func probeProgress() func(done, failed, total int) {
+	if isTerminal(os.Stderr) && !*quiet {
+		return func(done, failed, total int) {
+			stderr.SetStatus(fmt.Sprintf("Probing mirrors %d/%d, %d failed", done, total, failed))
+		}
+	}
+
+	last := time.Now()
+	return func(done, failed, total int) {
+		if time.Since(last) >= progressLogInterval {
+			last = time.Now()
+			slog.Info("Probing mirrors", "done", done, "total", total, "failed", failed)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PapaTutuWawa/archmirror"
+)
+
+// A SOCKS5 proxy that only accepts user:pass and resolves the names in hosts
+// itself
+type socksProxy struct {
+	addr  string
+	hosts map[string]string
+
+	mu sync.Mutex
+	// The addresses the clients asked to connect to
+	requested []string
+}
+
+func newSOCKSProxy(t *testing.T, hosts map[string]string) *socksProxy {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	p := &socksProxy{addr: ln.Addr().String(), hosts: hosts}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go p.serve(conn)
+		}
+	}()
+	return p
+}
+
+func (p *socksProxy) serve(conn net.Conn) {
+	defer conn.Close()
+	buf := make([]byte, 256)
+	read := func(n int) []byte {
+		if _, err := io.ReadFull(conn, buf[:n]); err != nil {
+			return nil
+		}
+		return buf[:n]
+	}
+
+	// The greeting, we insist on username and password
+	hello := read(2)
+	if hello == nil || hello[0] != 5 {
+		return
+	}
+	methods := read(int(hello[1]))
+	if !slices.Contains(methods, 2) {
+		conn.Write([]byte{5, 0xff})
+		return
+	}
+	conn.Write([]byte{5, 2})
+	auth := read(2)
+	if auth == nil {
+		return
+	}
+	user := string(read(int(auth[1])))
+	plen := read(1)
+	if plen == nil {
+		return
+	}
+	if pass := string(read(int(plen[0]))); user != "user" || pass != "pass" {
+		conn.Write([]byte{1, 1})
+		return
+	}
+	conn.Write([]byte{1, 0})
+
+	// The CONNECT request
+	req := read(4)
+	if req == nil || req[1] != 1 {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		host = net.IP(read(4)).String()
+	case 3:
+		n := read(1)
+		if n == nil {
+			return
+		}
+		host = string(read(int(n[0])))
+	case 4:
+		host = net.IP(read(16)).String()
+	}
+	port := read(2)
+	if port == nil {
+		return
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	p.mu.Lock()
+	p.requested = append(p.requested, addr)
+	p.mu.Unlock()
+
+	target, ok := p.hosts[addr]
+	if !ok {
+		// Host unreachable
+		conn.Write([]byte{5, 4, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		conn.Write([]byte{5, 4, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	go io.Copy(upstream, conn)
+	io.Copy(conn, upstream)
+}
+
+func (p *socksProxy) requestedAddrs() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.requested)
+}
+
+// Use the transport of -proxy u
+func proxyClient(t *testing.T, u string) *http.Client {
+	t.Helper()
+	saved := *proxy
+	*proxy = u
+	t.Cleanup(func() { *proxy = saved })
+
+	transport, err := newTransport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(transport.CloseIdleConnections)
+	return &http.Client{Transport: transport}
+}
+
+// Both hostnames only exist for the proxy
+const (
+	proxiedGenerator = "generator.test"
+	proxiedMirror    = "mirror.test"
+)
+
+func proxiedConfig() *archmirror.MirrorListConfig {
+	return &archmirror.MirrorListConfig{
+		Protocols:  []archmirror.ProtocolType{archmirror.ProtocolTypeHTTP},
+		IPVersions: []archmirror.IPVersion{archmirror.IPVersion4},
+		Countries:  []string{"DE"},
+		BaseURL:    "http://" + proxiedGenerator + "/mirrorlist/",
+	}
+}
+
+func proxiedMirrorlist() *archmirror.Mirrorlist {
+	return &archmirror.Mirrorlist{Mirrors: []archmirror.Mirror{{
+		URL:      "http://" + proxiedMirror + "/$repo/os/$arch",
+		Protocol: archmirror.ProtocolTypeHTTP,
+		Country:  "Germany",
+		Active:   true,
+	}}}
+}
+
+func rankOptions(client *http.Client) archmirror.RankOptions {
+	return archmirror.RankOptions{Mode: archmirror.RankLatency, Timeout: 5 * time.Second, Threads: 1, Client: client}
+}
+
+func TestSOCKS5Proxy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host == proxiedGenerator {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("## Germany\n#Server = http://" + proxiedMirror + "/$repo/os/$arch\n"))
+			return
+		}
+		w.Write([]byte("signature"))
+	}))
+	t.Cleanup(srv.Close)
+	target := srv.Listener.Addr().String()
+	p := newSOCKSProxy(t, map[string]string{proxiedGenerator + ":80": target, proxiedMirror + ":80": target})
+	client := proxyClient(t, "socks5://user:pass@"+p.addr)
+
+	list, err := archmirror.RequestMirrorListWithClient(client, proxiedConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Mirrors) != 1 || list.Mirrors[0].URL != proxiedMirrorlist().Mirrors[0].URL {
+		t.Fatalf("got %v from the generator behind the proxy", list.Mirrors)
+	}
+
+	summary := archmirror.Rank(t.Context(), list, rankOptions(client))
+	if err := summary.Results[0].Err; err != nil {
+		t.Fatalf("probing the mirror behind the proxy: %v", err)
+	}
+
+	// The names were sent to the proxy, not resolved by us
+	want := []string{proxiedGenerator + ":80", proxiedMirror + ":80"}
+	if got := p.requestedAddrs(); !slices.Equal(got, want) {
+		t.Errorf("the proxy was asked for %q, want %q", got, want)
+	}
+}
+
+func TestSOCKS5ProxyUnreachable(t *testing.T) {
+	// Nothing listens there anymore
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	client := proxyClient(t, "socks5://user:pass@"+addr)
+
+	_, err = archmirror.RequestMirrorListWithClient(client, proxiedConfig())
+	if !errors.Is(err, archmirror.ErrProxyUnreachable) {
+		t.Errorf("requesting the mirrorlist: got %v, want %v", err, archmirror.ErrProxyUnreachable)
+	}
+
+	summary := archmirror.Rank(t.Context(), proxiedMirrorlist(), rankOptions(client))
+	if err := summary.Results[0].Err; !errors.Is(err, archmirror.ErrProxyUnreachable) {
+		t.Errorf("probing a mirror: got %v, want %v", err, archmirror.ErrProxyUnreachable)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/PapaTutuWawa/archmirror"
+)
+
+// A step of a refresh that removed mirrors
+type summaryStep struct {
+	Step    string `json:"step"`
+	Removed int    `json:"removed"`
+	// The mirrors that were left afterwards
+	Left int `json:"left"`
+}
+
+func (s summaryStep) String() string {
+	return fmt.Sprintf("%s removed %d", s.Step, s.Removed)
+}
+
+// What the run was asked to do
+type summaryParams struct {
+	Flavor     string   `json:"flavor"`
+	Arch       string   `json:"arch"`
+	Countries  []string `json:"countries"`
+	Protocols  []string `json:"protocols"`
+	IPVersions []string `json:"ip_versions"`
+	Rank       string   `json:"rank,omitempty"`
+	// The options that do not have their default value
+	Args []string `json:"args"`
+}
+
+// The measurement of a single mirror
+type summaryProbe struct {
+	URL       string  `json:"url"`
+	LatencyMS float64 `json:"latency_ms,omitempty"`
+	// The range of the samples with -samples
+	MinLatencyMS float64 `json:"min_latency_ms,omitempty"`
+	MaxLatencyMS float64 `json:"max_latency_ms,omitempty"`
+	Rate         float64 `json:"rate_bytes_per_second,omitempty"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// The version of the JSON summary, bumped when fields change their meaning or
+// go away
+const summarySchema = 1
+
+// The names accepted by -summary-format
+var summaryFormats = []string{"text", "json"}
+
+// What happened during a refresh, filled in as it goes
+type runSummary struct {
+	Schema   int           `json:"schema"`
+	Params   summaryParams `json:"params"`
+	Started  time.Time     `json:"started"`
+	Finished time.Time     `json:"finished"`
+	// Where the mirrors came from and how many there were
+	Source  string        `json:"source"`
+	Fetched int           `json:"fetched"`
+	Steps   []summaryStep `json:"steps"`
+	// The mirrors that were measured
+	Probed int            `json:"probed"`
+	Failed int            `json:"failed"`
+	Probes []summaryProbe `json:"probes"`
+	// How much the probes downloaded
+	Bytes int64 `json:"bytes"`
+	// How the mirrors were sorted, empty if they kept the order of the source
+	Order string `json:"order,omitempty"`
+	// The number of active mirrors in the result and what was done with them
+	Mirrors int    `json:"mirrors"`
+	Output  string `json:"output"`
+	Outcome string `json:"outcome,omitempty"`
+	// The mirrors differ from the ones in the file that was replaced
+	Changed bool `json:"changed"`
+	// The URLs of the active mirrors in the result, in order
+	Result []string `json:"result"`
+	// Why the run failed
+	Error string `json:"error,omitempty"`
+}
+
+// The outcomes of a refresh
+const (
+	outcomeWritten   = "written"
+	outcomeUnchanged = "unchanged"
+	outcomeDryRun    = "dry run"
+	outcomeStdout    = "stdout"
+)
+
+func newRunSummary(j *fetchJob) *runSummary {
+	params := summaryParams{
+		Flavor:     j.flavor.Name(),
+		Arch:       j.arch,
+		Countries:  append([]string{}, j.config.Countries...),
+		Protocols:  make([]string, 0, len(j.config.Protocols)),
+		IPVersions: make([]string, 0, len(j.config.IPVersions)),
+		Rank:       string(j.rank),
+		Args:       effectiveArgs(),
+	}
+	for _, p := range j.config.Protocols {
+		params.Protocols = append(params.Protocols, p.String())
+	}
+	for _, v := range j.config.IPVersions {
+		params.IPVersions = append(params.IPVersions, v.String())
+	}
+
+	return &runSummary{
+		Schema:  summarySchema,
+		Params:  params,
+		Started: time.Now(),
+		Steps:   make([]summaryStep, 0),
+		Probes:  make([]summaryProbe, 0),
+		Result:  make([]string, 0),
+	}
+}
+
+// Record the measurements of the ranking
+func (s *runSummary) probes(r *archmirror.RankSummary) {
+	for _, result := range r.Results {
+		probe := summaryProbe{URL: result.Mirror.URL}
+		if result.Err != nil {
+			probe.Error = result.Err.Error()
+		} else {
+			probe.LatencyMS = milliseconds(result.Mirror.Latency)
+			probe.MinLatencyMS = milliseconds(result.MinLatency)
+			probe.MaxLatencyMS = milliseconds(result.MaxLatency)
+			probe.Rate = result.Mirror.Rate
+		}
+		s.Probes = append(s.Probes, probe)
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// Record that step removed some mirrors and left some
+func (s *runSummary) step(step string, removed, left int) {
+	s.Steps = append(s.Steps, summaryStep{step, removed, left})
+}
+
+// Tell the user how the run went. Without -log-format json it is printed as it
+// is, in bold.
+func logSummary(sum *runSummary) {
+	if *logFormat != "text" {
+		slog.Info(sum.String())
+		return
+	}
+	if !*quiet {
+		fmt.Fprintln(stderr, colors.Bold(sum.String()))
+	}
+}
+
+// Record what was done with the final list
+func (s *runSummary) finish(outcome string, l *archmirror.Mirrorlist) {
+	s.Outcome = outcome
+	s.Output = *outputFile
+	for _, m := range l.Mirrors {
+		if m.Active {
+			s.Result = append(s.Result, m.URL)
+		}
+	}
+	s.Mirrors = len(s.Result)
+}
+
+// Write the summary as a JSON document on a single line
+func (s *runSummary) writeJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s)
+}
+
+// The steps as lines for error messages
+func (s *runSummary) removals() []string {
+	lines := make([]string, 0, len(s.Steps))
+	for _, step := range s.Steps {
+		lines = append(lines, step.String())
+	}
+
+	return lines
+}
+
+// One line describing the whole run
+func (s *runSummary) String() string {
+	parts := []string{fmt.Sprintf("Got %d mirrors from %s", s.Fetched, s.Source)}
+	removed, steps := 0, 0
+	for _, step := range s.Steps {
+		if step.Removed > 0 {
+			removed += step.Removed
+			steps++
+		}
+	}
+	if removed > 0 {
+		plural := "s"
+		if steps == 1 {
+			plural = ""
+		}
+		parts = append(parts, fmt.Sprintf("%d removed in %d step%s", removed, steps, plural))
+	}
+	if s.Probed > 0 {
+		parts = append(parts, fmt.Sprintf("probed %d (%d failed, %s)", s.Probed, s.Failed, archmirror.FormatBytes(s.Bytes)))
+	}
+	if s.Order != "" {
+		parts = append(parts, "sorted by "+s.Order)
+	}
+
+	switch s.Outcome {
+	case outcomeWritten:
+		parts = append(parts, fmt.Sprintf("wrote %d to %s", s.Mirrors, s.Output))
+	case outcomeUnchanged:
+		parts = append(parts, fmt.Sprintf("%s already had these %d", s.Output, s.Mirrors))
+	case outcomeDryRun:
+		parts = append(parts, fmt.Sprintf("would write %d to %s", s.Mirrors, s.Output))
+	case outcomeStdout:
+		parts = append(parts, fmt.Sprintf("printed %d", s.Mirrors))
+	}
+
+	return strings.Join(parts, ", ") + fmt.Sprintf(" in %s", s.Finished.Sub(s.Started).Round(time.Millisecond))
+}
@@ -0,0 +1,70 @@
+# bash completion for archmirror, generated by archmirror completion bash
+
+_archmirror() {
+	local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}" cmd=fetch
+	case "${COMP_WORDS[1]}" in
+	completion|countries|fetch|install-units|rank|status|validate|version) cmd="${COMP_WORDS[1]}" ;;
+	esac
+
+	case "$prev" in
+	-arch)
+		COMPREPLY=($(compgen -W "x86_64 aarch64 armv7h riscv64" -- "$cur"))
+		return
+		;;
+	-branch)
+		COMPREPLY=($(compgen -W "stable testing unstable" -- "$cur"))
+		return
+		;;
+	-color)
+		COMPREPLY=($(compgen -W "auto always never" -- "$cur"))
+		return
+		;;
+	-country)
+		COMPREPLY=($(compgen -W "all AU AT AZ BD BY BE BA BR BG KH CA CL CN CO HR CZ DK EC EE FI FR GE DE GR HK HU IS IN ID IR IL IT JP KZ KE LV LT LU MU MX MD MC NL NC NZ MK NO PY PL PT RE RO RU RS SG SK SI ZA KR ES SE CH TW TH TR UA GB US UZ VN" -- "$cur"))
+		return
+		;;
+	-flavor)
+		COMPREPLY=($(compgen -W "alarm arch manjaro" -- "$cur"))
+		return
+		;;
+	-log-format)
+		COMPREPLY=($(compgen -W "text json" -- "$cur"))
+		return
+		;;
+	-output-format)
+		COMPREPLY=($(compgen -W "json pacman plain yaml" -- "$cur"))
+		return
+		;;
+	-protocol)
+		COMPREPLY=($(compgen -W "http https rsync" -- "$cur"))
+		return
+		;;
+	-rank)
+		COMPREPLY=($(compgen -W "latency rate" -- "$cur"))
+		return
+		;;
+	-sort)
+		COMPREPLY=($(compgen -W "rate latency score age delay country random" -- "$cur"))
+		return
+		;;
+	-summary-format)
+		COMPREPLY=($(compgen -W "text json" -- "$cur"))
+		return
+		;;
+	esac
+
+	if [[ $cur == -* ]]; then
+		case "$cmd" in
+		countries) COMPREPLY=($(compgen -W "-ca-file -color -config -deadline -insecure -json -log-format -no-follow-redirects -proxy -q -quiet -timeout -url -user-agent -v -verbose -vv" -- "$cur")) ;;
+		fetch) COMPREPLY=($(compgen -W "-4 -6 -activate-top -age -all-countries -allow-unknown-arch -arch -backup -backup-keep -branch -ca-file -cache-ttl -clear-failure-cache -color -completion-percent -config -country -daemon -deadline -diff -drop-unscored -dry-run -exclude -exec -exec-required -failure-expiry -flavor -force -force-write -group-by-country -http -https -in -in-commented -include-from -insecure -interactive -interval -json -keep-excluded-commented -keep-unknown -keep-unknown-sync -list-countries -lock-timeout -log-format -max-delay -max-lag -max-sync-age -merge -min-mirrors -n -no-backup -no-cache -no-failure-cache -no-follow-redirects -no-header -no-validate -noconfirm -notify -out -output-format -print-config -probe-max-bytes -probe-max-total -probe-timeout -protocol -proxy -q -quiet -rank -refresh -require-ipv4-reachable -require-ipv6-reachable -retries -samples -shuffle -sort -status -stdout -strict -summary-format -summary-json -test-file -threads -tier -timeout -uncomment -url -user-agent -v -verbose -verify-sync -version -vv -warmup -write-partial -yes" -- "$cur")) ;;
+		install-units) COMPREPLY=($(compgen -W "-force -hook-dir -hook-max-age -on-calendar -unit-dir -write" -- "$cur")) ;;
+		rank) COMPREPLY=($(compgen -W "-4 -6 -activate-top -age -all-countries -allow-unknown-arch -arch -backup -backup-keep -branch -ca-file -cache-ttl -clear-failure-cache -color -completion-percent -config -country -daemon -deadline -diff -drop-unscored -dry-run -exclude -exec -exec-required -failure-expiry -flavor -force -force-write -group-by-country -http -https -in -in-commented -include-from -insecure -interactive -interval -json -keep-excluded-commented -keep-unknown -keep-unknown-sync -list-countries -lock-timeout -log-format -max-delay -max-lag -max-sync-age -merge -min-mirrors -n -no-backup -no-cache -no-failure-cache -no-follow-redirects -no-header -no-validate -noconfirm -notify -out -output-format -print-config -probe-max-bytes -probe-max-total -probe-timeout -protocol -proxy -q -quiet -rank -refresh -require-ipv4-reachable -require-ipv6-reachable -retries -samples -shuffle -sort -status -stdout -strict -summary-format -summary-json -test-file -threads -tier -timeout -uncomment -url -user-agent -v -verbose -verify-sync -version -vv -warmup -write-partial -yes" -- "$cur")) ;;
+		status) COMPREPLY=($(compgen -W "-ca-file -color -config -country -deadline -insecure -log-format -no-follow-redirects -proxy -q -quiet -timeout -url -user-agent -v -verbose -vv" -- "$cur")) ;;
+		validate) COMPREPLY=($(compgen -W "-ca-file -color -config -deadline -flavor -insecure -log-format -no-follow-redirects -proxy -q -quiet -timeout -url -user-agent -v -verbose -vv" -- "$cur")) ;;
+		esac
+	elif [[ $COMP_CWORD -eq 1 ]]; then
+		COMPREPLY=($(compgen -W "completion countries fetch install-units rank status validate version" -- "$cur"))
+	fi
+}
+
+complete -o default -F _archmirror archmirror
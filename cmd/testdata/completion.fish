@@ -0,0 +1,276 @@
+# fish completion for archmirror, generated by archmirror completion fish
+
+function __archmirror_using
+	set -l words (commandline -opc)
+	set -l cmd fetch
+	if set -q words[2]; and contains -- $words[2] completion countries fetch install-units rank status validate version
+		set cmd $words[2]
+	end
+	contains -- $cmd $argv
+end
+
+complete -c archmirror -n __fish_use_subcommand -f -a completion -d 'Print a completion script for bash, zsh or fish'
+complete -c archmirror -n __fish_use_subcommand -f -a countries -d 'List the countries the generator offers'
+complete -c archmirror -n __fish_use_subcommand -f -a fetch -d 'Fetch, filter, rank and write a mirrorlist (the default)'
+complete -c archmirror -n __fish_use_subcommand -f -a install-units -d 'Print or install a systemd service and timer running fetch'
+complete -c archmirror -n __fish_use_subcommand -f -a rank -d 'Rank the mirrors of an existing mirrorlist, fetch -in /etc/pacman.d/mirrorlist -rank latency'
+complete -c archmirror -n __fish_use_subcommand -f -a status -d 'Show what archlinux.org knows about the mirrors'
+complete -c archmirror -n __fish_use_subcommand -f -a validate -d 'Check that the active Server lines of a mirrorlist are usable by pacman'
+complete -c archmirror -n __fish_use_subcommand -f -a version -d 'Show which build of archmirror this is, like -version'
+
+complete -c archmirror -n '__archmirror_using countries' -o ca-file -d 'Also trust the certificates in this PEM file' -r -F
+complete -c archmirror -n '__archmirror_using countries' -o color -d 'Color the warnings and errors on stderr (auto, always, never), auto colors them on a terminal unless NO_COLOR is set' -x -a 'auto always never'
+complete -c archmirror -n '__archmirror_using countries' -o config -d 'Read the options from this file instead of $XDG_CONFIG_HOME/archmirror/config.toml and /etc/archmirror.conf' -r -F
+complete -c archmirror -n '__archmirror_using countries' -o deadline -d 'Give up when the whole run takes longer than this, 0 means no limit' -r -F
+complete -c archmirror -n '__archmirror_using countries' -o insecure -d 'Do not verify TLS certificates (dangerous, only for debugging)'
+complete -c archmirror -n '__archmirror_using countries' -o json -d 'Print the countries as JSON'
+complete -c archmirror -n '__archmirror_using countries' -o log-format -d 'Format of the messages on stderr (text, json)' -x -a 'text json'
+complete -c archmirror -n '__archmirror_using countries' -o no-follow-redirects -d 'Report redirects of archlinux.org instead of following them, for debugging custom -url endpoints'
+complete -c archmirror -n '__archmirror_using countries' -o proxy -d 'Send all requests through this HTTP(S) or SOCKS5 proxy instead of the one from the environment' -r -F
+complete -c archmirror -n '__archmirror_using countries' -o q -d 'Short for -quiet'
+complete -c archmirror -n '__archmirror_using countries' -o quiet -d 'Only print errors'
+complete -c archmirror -n '__archmirror_using countries' -o timeout -d 'Give up on requests to archlinux.org after this long, 0 means no limit' -r -F
+complete -c archmirror -n '__archmirror_using countries' -o url -d 'Ask the mirrorlist generator at this URL' -r -F
+complete -c archmirror -n '__archmirror_using countries' -o user-agent -d 'Send this User-Agent instead of archmirror/<version>' -r -F
+complete -c archmirror -n '__archmirror_using countries' -o v -d 'Short for -verbose'
+complete -c archmirror -n '__archmirror_using countries' -o verbose -d 'Print more information about what is happening'
+complete -c archmirror -n '__archmirror_using countries' -o vv -d 'Print even more information, including every probe'
+
+complete -c archmirror -n '__archmirror_using fetch' -o 4 -d 'Include IPv4 mirrors'
+complete -c archmirror -n '__archmirror_using fetch' -o 6 -d 'Include IPv6 mirrors'
+complete -c archmirror -n '__archmirror_using fetch' -o activate-top -d 'Only activate this many mirrors and write the rest as commented out fallbacks' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o age -d 'Remove mirrors that last synced more than this many hours ago' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o all-countries -d 'Include mirrors from all countries'
+complete -c archmirror -n '__archmirror_using fetch' -o allow-unknown-arch -d 'Accept an -arch that archmirror does not know'
+complete -c archmirror -n '__archmirror_using fetch' -o arch -d 'The architecture whose databases are downloaded while ranking (x86_64, aarch64, armv7h, riscv64), the one of this machine if the mirrors have it' -x -a 'x86_64 aarch64 armv7h riscv64'
+complete -c archmirror -n '__archmirror_using fetch' -o backup -d 'Back up the output file before overwriting it'
+complete -c archmirror -n '__archmirror_using fetch' -o backup-keep -d 'Number of backups to keep after writing, -1 keeps all' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o branch -d 'The Manjaro branch with -flavor manjaro (stable, testing, unstable)' -x -a 'stable testing unstable'
+complete -c archmirror -n '__archmirror_using fetch' -o ca-file -d 'Also trust the certificates in this PEM file' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o cache-ttl -d 'Use a cached mirrorlist younger than this without asking archlinux.org, 0 always asks' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o clear-failure-cache -d 'Forget all mirrors that failed a probe'
+complete -c archmirror -n '__archmirror_using fetch' -o color -d 'Color the warnings and errors on stderr (auto, always, never), auto colors them on a terminal unless NO_COLOR is set' -x -a 'auto always never'
+complete -c archmirror -n '__archmirror_using fetch' -o completion-percent -d 'Remove mirrors that passed less than this percentage of the status checks' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o config -d 'Read the options from this file instead of $XDG_CONFIG_HOME/archmirror/config.toml and /etc/archmirror.conf' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o country -d 'Mirror location as country code or name (may be repeated or comma-separated)' -x -a 'all AU AT AZ BD BY BE BA BR BG KH CA CL CN CO HR CZ DK EC EE FI FR GE DE GR HK HU IS IN ID IR IL IT JP KZ KE LV LT LU MU MX MD MC NL NC NZ MK NO PY PL PT RE RO RU RS SG SK SI ZA KR ES SE CH TW TH TR UA GB US UZ VN'
+complete -c archmirror -n '__archmirror_using fetch' -o daemon -d 'Keep running and refresh the mirrorlist every -interval, replacing the output file'
+complete -c archmirror -n '__archmirror_using fetch' -o deadline -d 'Give up when the whole run takes longer than this, 0 means no limit' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o diff -d 'Show how the mirrors differ from the existing output file'
+complete -c archmirror -n '__archmirror_using fetch' -o drop-unscored -d 'Remove mirrors without a score when sorting by score'
+complete -c archmirror -n '__archmirror_using fetch' -o dry-run -d 'Show what would be written instead of writing the output file'
+complete -c archmirror -n '__archmirror_using fetch' -o exclude -d 'Remove mirrors whose URL or hostname matches the regular expression (may be repeated)' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o exec -d 'Run this shell command after the output file was written' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o exec-required -d 'Fail if the -exec command fails instead of only reporting it'
+complete -c archmirror -n '__archmirror_using fetch' -o failure-expiry -d 'How long mirrors that failed a probe are skipped' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o flavor -d 'The distribution whose mirrors are fetched (alarm, arch, manjaro)' -x -a 'alarm arch manjaro'
+complete -c archmirror -n '__archmirror_using fetch' -o force -d 'Overwrite the output file if it already exists'
+complete -c archmirror -n '__archmirror_using fetch' -o force-write -d 'Write the output file even if only its header would change'
+complete -c archmirror -n '__archmirror_using fetch' -o group-by-country -d 'Write the mirrors of each country together under one heading, keeping their order otherwise'
+complete -c archmirror -n '__archmirror_using fetch' -o http -d 'Include HTTP mirrors'
+complete -c archmirror -n '__archmirror_using fetch' -o https -d 'Include HTTPS mirrors'
+complete -c archmirror -n '__archmirror_using fetch' -o in -d 'Take the mirrors from this mirrorlist instead of fetching them, - reads a mirrorlist or a list of URLs from standard input' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o in-commented -d 'Also use the commented out mirrors of -in'
+complete -c archmirror -n '__archmirror_using fetch' -o include-from -d 'Only keep the mirrors whose hostname or URL prefix is listed in the file' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o insecure -d 'Do not verify TLS certificates (dangerous, only for debugging)'
+complete -c archmirror -n '__archmirror_using fetch' -o interactive -d 'Show the mirrors and ask which ones to write, in which order'
+complete -c archmirror -n '__archmirror_using fetch' -o interval -d 'How often to refresh the mirrorlist with -daemon' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o json -d 'Print the country list as JSON'
+complete -c archmirror -n '__archmirror_using fetch' -o keep-excluded-commented -d 'Write excluded mirrors as commented out lines'
+complete -c archmirror -n '__archmirror_using fetch' -o keep-unknown -d 'Keep mirrors without a status when filtering by status'
+complete -c archmirror -n '__archmirror_using fetch' -o keep-unknown-sync -d 'Keep mirrors without a usable lastsync file with -verify-sync'
+complete -c archmirror -n '__archmirror_using fetch' -o list-countries -d 'Print the countries the generator offers and exit'
+complete -c archmirror -n '__archmirror_using fetch' -o lock-timeout -d 'Wait this long for another archmirror writing the same output file, 0 gives up right away' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o log-format -d 'Format of the messages on stderr (text, json)' -x -a 'text json'
+complete -c archmirror -n '__archmirror_using fetch' -o max-delay -d 'Remove mirrors that are further behind than this' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o max-lag -d 'Drop mirrors whose lastupdate is further behind the one of the master mirror than this while ranking, 0 keeps all' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o max-sync-age -d 'How long ago a mirror may have synced with -verify-sync' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o merge -d 'Keep the mirrors of the output file that are not in the new list at the top'
+complete -c archmirror -n '__archmirror_using fetch' -o min-mirrors -d 'Fail instead of writing a mirrorlist with fewer active mirrors than this' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o n -d 'Maximum number of mirrors to write, 0 writes all' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o no-backup -d 'Never back up the output file, even with -backup'
+complete -c archmirror -n '__archmirror_using fetch' -o no-cache -d 'Always download the whole mirrorlist instead of reusing the cached copy'
+complete -c archmirror -n '__archmirror_using fetch' -o no-failure-cache -d 'Do not remember mirrors that failed a probe'
+complete -c archmirror -n '__archmirror_using fetch' -o no-follow-redirects -d 'Report redirects of archlinux.org instead of following them, for debugging custom -url endpoints'
+complete -c archmirror -n '__archmirror_using fetch' -o no-header -d 'Do not write the archmirror header with the time and parameters of the run'
+complete -c archmirror -n '__archmirror_using fetch' -o no-validate -d 'Do not check the country codes before sending the request'
+complete -c archmirror -n '__archmirror_using fetch' -o noconfirm -d 'Same as -yes'
+complete -c archmirror -n '__archmirror_using fetch' -o notify -d 'Show a desktop notification when -daemon changes the mirrorlist or keeps failing'
+complete -c archmirror -n '__archmirror_using fetch' -o out -d 'Output file (- for standard output)' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o output-format -d 'Format of the output (json, pacman, plain, yaml)' -x -a 'json pacman plain yaml'
+complete -c archmirror -n '__archmirror_using fetch' -o print-config -d 'Print the options after reading the configuration files and exit'
+complete -c archmirror -n '__archmirror_using fetch' -o probe-max-bytes -d 'How much -rank rate downloads from each mirror, e.g. 512K' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o probe-max-total -d 'How much -rank rate downloads in total, the remaining mirrors are only measured by latency (0 for no limit)' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o probe-timeout -d 'How long to wait for a single mirror when ranking' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o protocol -d 'Include mirrors with this protocol (http, https, rsync), overrides -http and -https (may be repeated or comma-separated)' -x -a 'http https rsync'
+complete -c archmirror -n '__archmirror_using fetch' -o proxy -d 'Send all requests through this HTTP(S) or SOCKS5 proxy instead of the one from the environment' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o q -d 'Short for -quiet'
+complete -c archmirror -n '__archmirror_using fetch' -o quiet -d 'Only print errors'
+complete -c archmirror -n '__archmirror_using fetch' -o rank -d 'Rank the mirrors by the given measurement (latency, rate)' -x -a 'latency rate'
+complete -c archmirror -n '__archmirror_using fetch' -o refresh -d 'Ask archlinux.org even if the cached mirrorlist is recent'
+complete -c archmirror -n '__archmirror_using fetch' -o require-ipv4-reachable -d 'Probe the mirrors over IPv4 only and drop the ones that cannot be reached over it'
+complete -c archmirror -n '__archmirror_using fetch' -o require-ipv6-reachable -d 'Probe the mirrors over IPv6 only and drop the ones that cannot be reached over it'
+complete -c archmirror -n '__archmirror_using fetch' -o retries -d 'How often to retry a failed mirrorlist request' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o samples -d 'Measure the latency of each mirror this often and rank by the median' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o shuffle -d 'Randomize the order of the mirrors within each country'
+complete -c archmirror -n '__archmirror_using fetch' -o sort -d 'Sort the mirrors by these comma-separated keys, each one breaking the ties of the one before (rate, latency, score, age, delay, country, random)' -x -a 'rate latency score age delay country random'
+complete -c archmirror -n '__archmirror_using fetch' -o status -d 'Fetch the mirror status from archlinux.org'
+complete -c archmirror -n '__archmirror_using fetch' -o stdout -d 'Write the mirrorlist to standard output instead of a file'
+complete -c archmirror -n '__archmirror_using fetch' -o strict -d 'Fail if the mirrors of one of several countries cannot be requested or a Server line is invalid'
+complete -c archmirror -n '__archmirror_using fetch' -o summary-format -d 'Format of the summary on stderr at the end of a run (text, json)' -x -a 'text json'
+complete -c archmirror -n '__archmirror_using fetch' -o summary-json -d 'Also write the summary of each run as JSON to this file' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o test-file -d 'Download this file below the root of every mirror for -rank rate, e.g. extra/os/$arch/extra.db, instead of the core database' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o threads -d 'Number of mirrors to probe at the same time' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o tier -d 'Only keep mirrors of this tier, -1 keeps all' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o timeout -d 'Give up on requests to archlinux.org after this long, 0 means no limit' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o uncomment -d 'Activate the mirrors that the generator comments out'
+complete -c archmirror -n '__archmirror_using fetch' -o url -d 'Ask the mirrorlist generator at this URL' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o user-agent -d 'Send this User-Agent instead of archmirror/<version>' -r -F
+complete -c archmirror -n '__archmirror_using fetch' -o v -d 'Short for -verbose'
+complete -c archmirror -n '__archmirror_using fetch' -o verbose -d 'Print more information about what is happening'
+complete -c archmirror -n '__archmirror_using fetch' -o verify-sync -d 'Check the lastsync file of every mirror while ranking and drop the ones that synced too long ago'
+complete -c archmirror -n '__archmirror_using fetch' -o version -d 'Print the version of archmirror and exit'
+complete -c archmirror -n '__archmirror_using fetch' -o vv -d 'Print even more information, including every probe'
+complete -c archmirror -n '__archmirror_using fetch' -o warmup -d 'Request a file from each mirror before measuring it, so that connecting to it is not measured'
+complete -c archmirror -n '__archmirror_using fetch' -o write-partial -d 'Write the mirrors measured so far when ranking is interrupted'
+complete -c archmirror -n '__archmirror_using fetch' -o yes -d 'Do not ask before replacing the output file'
+
+complete -c archmirror -n '__archmirror_using install-units' -o force -d 'Replace files that already exist with -write'
+complete -c archmirror -n '__archmirror_using install-units' -o hook-dir -d 'Where -write puts the pacman hook' -r -F
+complete -c archmirror -n '__archmirror_using install-units' -o hook-max-age -d 'Also create a pacman hook that warns when the mirrorlist is older than this many days, 0 creates none' -r -F
+complete -c archmirror -n '__archmirror_using install-units' -o on-calendar -d 'When the timer refreshes the mirrorlist, see systemd.time(7)' -r -F
+complete -c archmirror -n '__archmirror_using install-units' -o unit-dir -d 'Where -write puts the systemd units' -r -F
+complete -c archmirror -n '__archmirror_using install-units' -o write -d 'Install the files instead of printing them'
+
+complete -c archmirror -n '__archmirror_using rank' -o 4 -d 'Include IPv4 mirrors'
+complete -c archmirror -n '__archmirror_using rank' -o 6 -d 'Include IPv6 mirrors'
+complete -c archmirror -n '__archmirror_using rank' -o activate-top -d 'Only activate this many mirrors and write the rest as commented out fallbacks' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o age -d 'Remove mirrors that last synced more than this many hours ago' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o all-countries -d 'Include mirrors from all countries'
+complete -c archmirror -n '__archmirror_using rank' -o allow-unknown-arch -d 'Accept an -arch that archmirror does not know'
+complete -c archmirror -n '__archmirror_using rank' -o arch -d 'The architecture whose databases are downloaded while ranking (x86_64, aarch64, armv7h, riscv64), the one of this machine if the mirrors have it' -x -a 'x86_64 aarch64 armv7h riscv64'
+complete -c archmirror -n '__archmirror_using rank' -o backup -d 'Back up the output file before overwriting it'
+complete -c archmirror -n '__archmirror_using rank' -o backup-keep -d 'Number of backups to keep after writing, -1 keeps all' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o branch -d 'The Manjaro branch with -flavor manjaro (stable, testing, unstable)' -x -a 'stable testing unstable'
+complete -c archmirror -n '__archmirror_using rank' -o ca-file -d 'Also trust the certificates in this PEM file' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o cache-ttl -d 'Use a cached mirrorlist younger than this without asking archlinux.org, 0 always asks' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o clear-failure-cache -d 'Forget all mirrors that failed a probe'
+complete -c archmirror -n '__archmirror_using rank' -o color -d 'Color the warnings and errors on stderr (auto, always, never), auto colors them on a terminal unless NO_COLOR is set' -x -a 'auto always never'
+complete -c archmirror -n '__archmirror_using rank' -o completion-percent -d 'Remove mirrors that passed less than this percentage of the status checks' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o config -d 'Read the options from this file instead of $XDG_CONFIG_HOME/archmirror/config.toml and /etc/archmirror.conf' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o country -d 'Mirror location as country code or name (may be repeated or comma-separated)' -x -a 'all AU AT AZ BD BY BE BA BR BG KH CA CL CN CO HR CZ DK EC EE FI FR GE DE GR HK HU IS IN ID IR IL IT JP KZ KE LV LT LU MU MX MD MC NL NC NZ MK NO PY PL PT RE RO RU RS SG SK SI ZA KR ES SE CH TW TH TR UA GB US UZ VN'
+complete -c archmirror -n '__archmirror_using rank' -o daemon -d 'Keep running and refresh the mirrorlist every -interval, replacing the output file'
+complete -c archmirror -n '__archmirror_using rank' -o deadline -d 'Give up when the whole run takes longer than this, 0 means no limit' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o diff -d 'Show how the mirrors differ from the existing output file'
+complete -c archmirror -n '__archmirror_using rank' -o drop-unscored -d 'Remove mirrors without a score when sorting by score'
+complete -c archmirror -n '__archmirror_using rank' -o dry-run -d 'Show what would be written instead of writing the output file'
+complete -c archmirror -n '__archmirror_using rank' -o exclude -d 'Remove mirrors whose URL or hostname matches the regular expression (may be repeated)' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o exec -d 'Run this shell command after the output file was written' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o exec-required -d 'Fail if the -exec command fails instead of only reporting it'
+complete -c archmirror -n '__archmirror_using rank' -o failure-expiry -d 'How long mirrors that failed a probe are skipped' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o flavor -d 'The distribution whose mirrors are fetched (alarm, arch, manjaro)' -x -a 'alarm arch manjaro'
+complete -c archmirror -n '__archmirror_using rank' -o force -d 'Overwrite the output file if it already exists'
+complete -c archmirror -n '__archmirror_using rank' -o force-write -d 'Write the output file even if only its header would change'
+complete -c archmirror -n '__archmirror_using rank' -o group-by-country -d 'Write the mirrors of each country together under one heading, keeping their order otherwise'
+complete -c archmirror -n '__archmirror_using rank' -o http -d 'Include HTTP mirrors'
+complete -c archmirror -n '__archmirror_using rank' -o https -d 'Include HTTPS mirrors'
+complete -c archmirror -n '__archmirror_using rank' -o in -d 'Take the mirrors from this mirrorlist instead of fetching them, - reads a mirrorlist or a list of URLs from standard input' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o in-commented -d 'Also use the commented out mirrors of -in'
+complete -c archmirror -n '__archmirror_using rank' -o include-from -d 'Only keep the mirrors whose hostname or URL prefix is listed in the file' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o insecure -d 'Do not verify TLS certificates (dangerous, only for debugging)'
+complete -c archmirror -n '__archmirror_using rank' -o interactive -d 'Show the mirrors and ask which ones to write, in which order'
+complete -c archmirror -n '__archmirror_using rank' -o interval -d 'How often to refresh the mirrorlist with -daemon' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o json -d 'Print the country list as JSON'
+complete -c archmirror -n '__archmirror_using rank' -o keep-excluded-commented -d 'Write excluded mirrors as commented out lines'
+complete -c archmirror -n '__archmirror_using rank' -o keep-unknown -d 'Keep mirrors without a status when filtering by status'
+complete -c archmirror -n '__archmirror_using rank' -o keep-unknown-sync -d 'Keep mirrors without a usable lastsync file with -verify-sync'
+complete -c archmirror -n '__archmirror_using rank' -o list-countries -d 'Print the countries the generator offers and exit'
+complete -c archmirror -n '__archmirror_using rank' -o lock-timeout -d 'Wait this long for another archmirror writing the same output file, 0 gives up right away' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o log-format -d 'Format of the messages on stderr (text, json)' -x -a 'text json'
+complete -c archmirror -n '__archmirror_using rank' -o max-delay -d 'Remove mirrors that are further behind than this' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o max-lag -d 'Drop mirrors whose lastupdate is further behind the one of the master mirror than this while ranking, 0 keeps all' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o max-sync-age -d 'How long ago a mirror may have synced with -verify-sync' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o merge -d 'Keep the mirrors of the output file that are not in the new list at the top'
+complete -c archmirror -n '__archmirror_using rank' -o min-mirrors -d 'Fail instead of writing a mirrorlist with fewer active mirrors than this' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o n -d 'Maximum number of mirrors to write, 0 writes all' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o no-backup -d 'Never back up the output file, even with -backup'
+complete -c archmirror -n '__archmirror_using rank' -o no-cache -d 'Always download the whole mirrorlist instead of reusing the cached copy'
+complete -c archmirror -n '__archmirror_using rank' -o no-failure-cache -d 'Do not remember mirrors that failed a probe'
+complete -c archmirror -n '__archmirror_using rank' -o no-follow-redirects -d 'Report redirects of archlinux.org instead of following them, for debugging custom -url endpoints'
+complete -c archmirror -n '__archmirror_using rank' -o no-header -d 'Do not write the archmirror header with the time and parameters of the run'
+complete -c archmirror -n '__archmirror_using rank' -o no-validate -d 'Do not check the country codes before sending the request'
+complete -c archmirror -n '__archmirror_using rank' -o noconfirm -d 'Same as -yes'
+complete -c archmirror -n '__archmirror_using rank' -o notify -d 'Show a desktop notification when -daemon changes the mirrorlist or keeps failing'
+complete -c archmirror -n '__archmirror_using rank' -o out -d 'Output file (- for standard output)' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o output-format -d 'Format of the output (json, pacman, plain, yaml)' -x -a 'json pacman plain yaml'
+complete -c archmirror -n '__archmirror_using rank' -o print-config -d 'Print the options after reading the configuration files and exit'
+complete -c archmirror -n '__archmirror_using rank' -o probe-max-bytes -d 'How much -rank rate downloads from each mirror, e.g. 512K' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o probe-max-total -d 'How much -rank rate downloads in total, the remaining mirrors are only measured by latency (0 for no limit)' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o probe-timeout -d 'How long to wait for a single mirror when ranking' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o protocol -d 'Include mirrors with this protocol (http, https, rsync), overrides -http and -https (may be repeated or comma-separated)' -x -a 'http https rsync'
+complete -c archmirror -n '__archmirror_using rank' -o proxy -d 'Send all requests through this HTTP(S) or SOCKS5 proxy instead of the one from the environment' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o q -d 'Short for -quiet'
+complete -c archmirror -n '__archmirror_using rank' -o quiet -d 'Only print errors'
+complete -c archmirror -n '__archmirror_using rank' -o rank -d 'Rank the mirrors by the given measurement (latency, rate)' -x -a 'latency rate'
+complete -c archmirror -n '__archmirror_using rank' -o refresh -d 'Ask archlinux.org even if the cached mirrorlist is recent'
+complete -c archmirror -n '__archmirror_using rank' -o require-ipv4-reachable -d 'Probe the mirrors over IPv4 only and drop the ones that cannot be reached over it'
+complete -c archmirror -n '__archmirror_using rank' -o require-ipv6-reachable -d 'Probe the mirrors over IPv6 only and drop the ones that cannot be reached over it'
+complete -c archmirror -n '__archmirror_using rank' -o retries -d 'How often to retry a failed mirrorlist request' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o samples -d 'Measure the latency of each mirror this often and rank by the median' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o shuffle -d 'Randomize the order of the mirrors within each country'
+complete -c archmirror -n '__archmirror_using rank' -o sort -d 'Sort the mirrors by these comma-separated keys, each one breaking the ties of the one before (rate, latency, score, age, delay, country, random)' -x -a 'rate latency score age delay country random'
+complete -c archmirror -n '__archmirror_using rank' -o status -d 'Fetch the mirror status from archlinux.org'
+complete -c archmirror -n '__archmirror_using rank' -o stdout -d 'Write the mirrorlist to standard output instead of a file'
+complete -c archmirror -n '__archmirror_using rank' -o strict -d 'Fail if the mirrors of one of several countries cannot be requested or a Server line is invalid'
+complete -c archmirror -n '__archmirror_using rank' -o summary-format -d 'Format of the summary on stderr at the end of a run (text, json)' -x -a 'text json'
+complete -c archmirror -n '__archmirror_using rank' -o summary-json -d 'Also write the summary of each run as JSON to this file' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o test-file -d 'Download this file below the root of every mirror for -rank rate, e.g. extra/os/$arch/extra.db, instead of the core database' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o threads -d 'Number of mirrors to probe at the same time' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o tier -d 'Only keep mirrors of this tier, -1 keeps all' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o timeout -d 'Give up on requests to archlinux.org after this long, 0 means no limit' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o uncomment -d 'Activate the mirrors that the generator comments out'
+complete -c archmirror -n '__archmirror_using rank' -o url -d 'Ask the mirrorlist generator at this URL' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o user-agent -d 'Send this User-Agent instead of archmirror/<version>' -r -F
+complete -c archmirror -n '__archmirror_using rank' -o v -d 'Short for -verbose'
+complete -c archmirror -n '__archmirror_using rank' -o verbose -d 'Print more information about what is happening'
+complete -c archmirror -n '__archmirror_using rank' -o verify-sync -d 'Check the lastsync file of every mirror while ranking and drop the ones that synced too long ago'
+complete -c archmirror -n '__archmirror_using rank' -o version -d 'Print the version of archmirror and exit'
+complete -c archmirror -n '__archmirror_using rank' -o vv -d 'Print even more information, including every probe'
+complete -c archmirror -n '__archmirror_using rank' -o warmup -d 'Request a file from each mirror before measuring it, so that connecting to it is not measured'
+complete -c archmirror -n '__archmirror_using rank' -o write-partial -d 'Write the mirrors measured so far when ranking is interrupted'
+complete -c archmirror -n '__archmirror_using rank' -o yes -d 'Do not ask before replacing the output file'
+
+complete -c archmirror -n '__archmirror_using status' -o ca-file -d 'Also trust the certificates in this PEM file' -r -F
+complete -c archmirror -n '__archmirror_using status' -o color -d 'Color the warnings and errors on stderr (auto, always, never), auto colors them on a terminal unless NO_COLOR is set' -x -a 'auto always never'
+complete -c archmirror -n '__archmirror_using status' -o config -d 'Read the options from this file instead of $XDG_CONFIG_HOME/archmirror/config.toml and /etc/archmirror.conf' -r -F
+complete -c archmirror -n '__archmirror_using status' -o country -d 'Only show mirrors in this country, as code or name (may be repeated or comma-separated)' -x -a 'all AU AT AZ BD BY BE BA BR BG KH CA CL CN CO HR CZ DK EC EE FI FR GE DE GR HK HU IS IN ID IR IL IT JP KZ KE LV LT LU MU MX MD MC NL NC NZ MK NO PY PL PT RE RO RU RS SG SK SI ZA KR ES SE CH TW TH TR UA GB US UZ VN'
+complete -c archmirror -n '__archmirror_using status' -o deadline -d 'Give up when the whole run takes longer than this, 0 means no limit' -r -F
+complete -c archmirror -n '__archmirror_using status' -o insecure -d 'Do not verify TLS certificates (dangerous, only for debugging)'
+complete -c archmirror -n '__archmirror_using status' -o log-format -d 'Format of the messages on stderr (text, json)' -x -a 'text json'
+complete -c archmirror -n '__archmirror_using status' -o no-follow-redirects -d 'Report redirects of archlinux.org instead of following them, for debugging custom -url endpoints'
+complete -c archmirror -n '__archmirror_using status' -o proxy -d 'Send all requests through this HTTP(S) or SOCKS5 proxy instead of the one from the environment' -r -F
+complete -c archmirror -n '__archmirror_using status' -o q -d 'Short for -quiet'
+complete -c archmirror -n '__archmirror_using status' -o quiet -d 'Only print errors'
+complete -c archmirror -n '__archmirror_using status' -o timeout -d 'Give up on requests to archlinux.org after this long, 0 means no limit' -r -F
+complete -c archmirror -n '__archmirror_using status' -o url -d 'Ask the mirrorlist generator at this URL' -r -F
+complete -c archmirror -n '__archmirror_using status' -o user-agent -d 'Send this User-Agent instead of archmirror/<version>' -r -F
+complete -c archmirror -n '__archmirror_using status' -o v -d 'Short for -verbose'
+complete -c archmirror -n '__archmirror_using status' -o verbose -d 'Print more information about what is happening'
+complete -c archmirror -n '__archmirror_using status' -o vv -d 'Print even more information, including every probe'
+
+complete -c archmirror -n '__archmirror_using validate' -o ca-file -d 'Also trust the certificates in this PEM file' -r -F
+complete -c archmirror -n '__archmirror_using validate' -o color -d 'Color the warnings and errors on stderr (auto, always, never), auto colors them on a terminal unless NO_COLOR is set' -x -a 'auto always never'
+complete -c archmirror -n '__archmirror_using validate' -o config -d 'Read the options from this file instead of $XDG_CONFIG_HOME/archmirror/config.toml and /etc/archmirror.conf' -r -F
+complete -c archmirror -n '__archmirror_using validate' -o deadline -d 'Give up when the whole run takes longer than this, 0 means no limit' -r -F
+complete -c archmirror -n '__archmirror_using validate' -o flavor -d 'The distribution whose mirrors are fetched (alarm, arch, manjaro)' -x -a 'alarm arch manjaro'
+complete -c archmirror -n '__archmirror_using validate' -o insecure -d 'Do not verify TLS certificates (dangerous, only for debugging)'
+complete -c archmirror -n '__archmirror_using validate' -o log-format -d 'Format of the messages on stderr (text, json)' -x -a 'text json'
+complete -c archmirror -n '__archmirror_using validate' -o no-follow-redirects -d 'Report redirects of archlinux.org instead of following them, for debugging custom -url endpoints'
+complete -c archmirror -n '__archmirror_using validate' -o proxy -d 'Send all requests through this HTTP(S) or SOCKS5 proxy instead of the one from the environment' -r -F
+complete -c archmirror -n '__archmirror_using validate' -o q -d 'Short for -quiet'
+complete -c archmirror -n '__archmirror_using validate' -o quiet -d 'Only print errors'
+complete -c archmirror -n '__archmirror_using validate' -o timeout -d 'Give up on requests to archlinux.org after this long, 0 means no limit' -r -F
+complete -c archmirror -n '__archmirror_using validate' -o url -d 'Ask the mirrorlist generator at this URL' -r -F
+complete -c archmirror -n '__archmirror_using validate' -o user-agent -d 'Send this User-Agent instead of archmirror/<version>' -r -F
+complete -c archmirror -n '__archmirror_using validate' -o v -d 'Short for -verbose'
+complete -c archmirror -n '__archmirror_using validate' -o verbose -d 'Print more information about what is happening'
+complete -c archmirror -n '__archmirror_using validate' -o vv -d 'Print even more information, including every probe'
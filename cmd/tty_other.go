@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// Whether f is a terminal rather than a pipe or a file. /dev/null counts as
+// one here.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PapaTutuWawa/archmirror"
+)
+
+// Where -write puts the units
+const (
+	defaultUnitDir = "/etc/systemd/system"
+	defaultHookDir = "/etc/pacman.d/hooks"
+)
+
+// A file to be installed
+type unitFile struct {
+	path    string
+	content string
+}
+
+// Quote an argument of ExecStart for systemd
+func systemdQuote(arg string) string {
+	// Specifiers and variables are expanded even inside quotes
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	arg = strings.ReplaceAll(arg, "$", "$$")
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\"'\\;") {
+		return arg
+	}
+
+	arg = strings.ReplaceAll(arg, `\`, `\\`)
+	arg = strings.ReplaceAll(arg, `"`, `\"`)
+	return `"` + arg + `"`
+}
+
+// Quote an argument of a pacman hook's Exec
+func hookQuote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\") {
+		return arg
+	}
+
+	arg = strings.ReplaceAll(arg, `\`, `\\`)
+	arg = strings.ReplaceAll(arg, `"`, `\"`)
+	return `"` + arg + `"`
+}
+
+// The service running fetch with args. In daemon mode it keeps running,
+// otherwise the timer starts it.
+func serviceUnit(exe string, args []string) string {
+	command := []string{systemdQuote(exe), "fetch"}
+	for _, a := range args {
+		command = append(command, systemdQuote(a))
+	}
+
+	unit := []string{
+		"[Unit]",
+		"Description=Refresh the pacman mirrorlist",
+		"Wants=network-online.target",
+		"After=network-online.target",
+		"",
+		"[Service]",
+	}
+	if *daemon {
+		unit = append(unit, "Type=notify", "Restart=on-failure")
+	} else {
+		unit = append(unit, "Type=oneshot")
+	}
+	unit = append(unit, "ExecStart="+strings.Join(command, " "))
+	if *daemon {
+		unit = append(unit, "", "[Install]", "WantedBy=multi-user.target")
+	}
+
+	return strings.Join(unit, "\n") + "\n"
+}
+
+func timerUnit(onCalendar string) string {
+	return strings.Join([]string{
+		"[Unit]",
+		"Description=Refresh the pacman mirrorlist regularly",
+		"",
+		"[Timer]",
+		"OnCalendar=" + onCalendar,
+		"Persistent=true",
+		"RandomizedDelaySec=1h",
+		"",
+		"[Install]",
+		"WantedBy=timers.target",
+	}, "\n") + "\n"
+}
+
+// A pacman hook that warns before a transaction when the mirrorlist at path
+// is older than days
+func hookFile(path string, days int) string {
+	warning := fmt.Sprintf(`warning: %%p is %d or more days old, refresh it with archmirror\n`, days)
+	return strings.Join([]string{
+		"[Trigger]",
+		"Operation = Install",
+		"Operation = Upgrade",
+		"Type = Package",
+		"Target = *",
+		"",
+		"[Action]",
+		"Description = Checking the age of the mirrorlist...",
+		"When = PreTransaction",
+		fmt.Sprintf("Exec = /usr/bin/find %s -mtime +%d -printf %s", hookQuote(path), days-1, hookQuote(warning)),
+	}, "\n") + "\n"
+}
+
+// The flags of install-units
+var units struct {
+	onCalendar       string
+	hookAge          int
+	write, overwrite bool
+	unitDir, hookDir string
+}
+
+func installUnitsFlags() *flag.FlagSet {
+	fs := flag.NewFlagSet("install-units", flag.ContinueOnError)
+	fs.StringVar(&units.onCalendar, "on-calendar", "weekly", "When the timer refreshes the mirrorlist, see systemd.time(7)")
+	fs.IntVar(&units.hookAge, "hook-max-age", 0, "Also create a pacman hook that warns when the mirrorlist is older than this many days, 0 creates none")
+	fs.BoolVar(&units.write, "write", false, "Install the files instead of printing them")
+	fs.BoolVar(&units.overwrite, "force", false, "Replace files that already exist with -write")
+	fs.StringVar(&units.unitDir, "unit-dir", defaultUnitDir, "Where -write puts the systemd units")
+	fs.StringVar(&units.hookDir, "hook-dir", defaultHookDir, "Where -write puts the pacman hook")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s install-units [flags] [-- fetch flags]\n\n%s\n\n", os.Args[0], commands["install-units"].summary)
+		fmt.Fprintf(fs.Output(), "The options of fetch that are in effect, from the command line, the environment\nand the configuration files, are written into the service.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+
+	return fs
+}
+
+// archmirror install-units
+func installUnitsCommand(args []string) error {
+	fs := installUnitsFlags()
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// The options the service will run with
+	if err := parseFlags(flag.CommandLine, fs.Args()); err != nil {
+		return err
+	}
+	if _, err := applyConfig(flag.CommandLine); err != nil {
+		return usageError("Failed reading the configuration: %w", err)
+	}
+	if units.hookAge < 0 {
+		return usageError("The age must not be negative!")
+	}
+	if *outputFile == "-" || *toStdout || *dryRun {
+		return usageError("The service has to write a file!")
+	}
+
+	// The service does not run in the current directory
+	for _, name := range []string{"out", "include-from", "ca-file"} {
+		f := flag.Lookup(name)
+		if f.Value.String() == "" {
+			continue
+		}
+		path, err := filepath.Abs(f.Value.String())
+		if err != nil {
+			return usageError("Invalid path for -%s: %w", name, err)
+		}
+		flag.Set(name, path)
+		if _, ok := optionSources[name]; !ok {
+			optionSources[name] = "command line"
+		}
+	}
+
+	// Every run after the first replaces the mirrorlist
+	if !*force {
+		flag.Set("force", "true")
+		optionSources["force"] = "command line"
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return filesystemError("Failed finding the archmirror binary: %w", err)
+	}
+
+	files := []unitFile{{filepath.Join(units.unitDir, "archmirror.service"), serviceUnit(exe, effectiveArgs())}}
+	if !*daemon {
+		files = append(files, unitFile{filepath.Join(units.unitDir, "archmirror.timer"), timerUnit(units.onCalendar)})
+	}
+	if units.hookAge > 0 {
+		files = append(files, unitFile{filepath.Join(units.hookDir, "archmirror.hook"), hookFile(*outputFile, units.hookAge)})
+	}
+
+	if !units.write {
+		for i, f := range files {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("# %s\n%s", f.path, f.content)
+		}
+		return nil
+	}
+
+	for _, f := range files {
+		if err := archmirror.WriteFileAtomic(f.path, []byte(f.content), units.overwrite); err != nil {
+			if errors.Is(err, os.ErrExist) {
+				return filesystemError("Failed writing %s: %w\nUse -force to replace it", f.path, err)
+			}
+			return filesystemError("Failed writing %s: %w", f.path, err)
+		}
+		fmt.Printf("Wrote %s\n", f.path)
+	}
+	enable := "archmirror.timer"
+	if *daemon {
+		enable = "archmirror.service"
+	}
+	fmt.Printf("Run \"systemctl daemon-reload && systemctl enable --now %s\" to activate it\n", enable)
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/PapaTutuWawa/archmirror"
+)
+
+func validateFlags() *flag.FlagSet {
+	fs := newFlagSet("validate")
+	f := flag.CommandLine.Lookup("flavor")
+	fs.Var(f.Value, f.Name, f.Usage)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s validate [flags] FILE\n\n%s\n\nFlags:\n", os.Args[0], commands["validate"].summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// archmirror validate
+func validateCommand(args []string) error {
+	fs := validateFlags()
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageError("Name the mirrorlist to validate")
+	}
+	_, cleanup, err := setup(fs)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	flavor, err := archmirror.GetFlavor(*flavorName)
+	if err != nil {
+		return usageError("Invalid flavor: %w", err)
+	}
+	path := fs.Arg(0)
+	file, err := os.Open(path)
+	if err != nil {
+		return filesystemError("Failed reading the mirrorlist: %w", err)
+	}
+	defer file.Close()
+
+	errs, err := archmirror.ValidateMirrorlist(file, flavor.ServerSuffix())
+	if err != nil {
+		return filesystemError("Failed reading the mirrorlist: %w", err)
+	}
+	for _, e := range errs {
+		fmt.Fprintf(os.Stdout, "%s:%d: %s: %s\n", path, e.Line, e.URL, e.Reason)
+	}
+	if len(errs) > 0 {
+		return invalidError("%s has %d invalid Server lines", path, len(errs))
+	}
+	slog.Info("All active Server lines are valid", "path", path)
+
+	return nil
+}
+
+// Look for Server lines pacman cannot use in the rendered mirrorlist. They
+// came from the source or the old mirrorlist, so they are only warned about
+// unless -strict is set.
+func checkServerLines(rendered []byte, j *fetchJob, source string) error {
+	errs, err := archmirror.ValidateMirrorlist(bytes.NewReader(rendered), j.flavor.ServerSuffix())
+	if err != nil {
+		return invalidError("Failed validating the mirrorlist: %w", err)
+	}
+	for _, e := range errs {
+		if e.Kept {
+			slog.Warn("A Server line kept from the old mirrorlist by -merge is invalid", "line", e.Line, "url", e.URL, "reason", e.Reason)
+		} else {
+			slog.Warn("Invalid Server line from "+source, "line", e.Line, "url", e.URL, "reason", e.Reason)
+		}
+	}
+	if *strict && len(errs) > 0 {
+		return invalidError("Not writing a mirrorlist with %d invalid Server lines!", len(errs))
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package archmirror
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The configuration file that applies to every user
+const SystemConfigPath = "/etc/archmirror.conf"
+
+// A "key = value" line of a configuration file
+type ConfigEntry struct {
+	Key string
+	// Arrays have more than one value
+	Values []string
+	// Where the entry was found
+	Line int
+}
+
+// A parsed configuration file. The keys are the names of the command line
+// flags.
+type Config struct {
+	Path    string
+	Entries []ConfigEntry
+}
+
+// The configuration files in the order they are read, the user's own file
+// first. Each file only sets what the previous ones have not.
+func DefaultConfigPaths() []string {
+	paths := make([]string, 0, 2)
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "archmirror", "config.toml"))
+	}
+
+	return append(paths, SystemConfigPath)
+}
+
+// Parse a single value, which is either bare or a quoted string
+func parseConfigValue(value string) (string, error) {
+	if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "'") {
+		if strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") && len(value) >= 2 {
+			// Literal strings as in TOML
+			return value[1 : len(value)-1], nil
+		}
+		return strconv.Unquote(value)
+	}
+
+	return value, nil
+}
+
+// Remove a # comment after the value, like "rank = "rate" # fastest". A #
+// inside quotes is part of the value.
+func stripConfigComment(value string) string {
+	var quote rune
+	escaped := false
+	for i, c := range value {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0 && c == '\\' && quote == '"':
+			escaped = true
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return strings.TrimSpace(value[:i])
+		}
+	}
+
+	return value
+}
+
+// Split the elements of an array, respecting commas inside quotes
+func splitConfigArray(inner string) ([]string, error) {
+	elements := make([]string, 0)
+	start := 0
+	var quote rune
+	escaped := false
+	for i, c := range inner {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0 && c == '\\' && quote == '"':
+			escaped = true
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == ',':
+			elements = append(elements, inner[start:i])
+			start = i + 1
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated string")
+	}
+	elements = append(elements, inner[start:])
+
+	values := make([]string, 0, len(elements))
+	for _, e := range elements {
+		e = strings.TrimSpace(e)
+		// A trailing comma is fine
+		if e == "" {
+			continue
+		}
+		v, err := parseConfigValue(e)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+
+	return values, nil
+}
+
+// Parse a configuration file consisting of "key = value" lines. Values may be
+// quoted and arrays are written as ["a", "b"]. Lines starting with # or ;
+// are comments, as is everything after a # outside of quotes, and [sections]
+// are ignored, so simple TOML and INI files both work.
+func ParseConfig(r io.Reader) (*Config, error) {
+	config := &Config{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "[") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key = strings.TrimSpace(key)
+		value = stripConfigComment(strings.TrimSpace(value))
+		if key == "" {
+			return nil, fmt.Errorf("line %d: missing key", n)
+		}
+
+		entry := ConfigEntry{Key: key, Line: n}
+		if strings.HasPrefix(value, "[") {
+			if !strings.HasSuffix(value, "]") {
+				return nil, fmt.Errorf("line %d: unterminated array", n)
+			}
+			values, err := splitConfigArray(value[1 : len(value)-1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			entry.Values = values
+		} else {
+			v, err := parseConfigValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid value: %w", n, err)
+			}
+			entry.Values = []string{v}
+		}
+		config.Entries = append(config.Entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Read a configuration file
+func LoadConfig(path string) (*Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config, err := ParseConfig(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	config.Path = path
+
+	return config, nil
+}
+
+// Set the flags of fs from the configuration. Flags that already have a
+// source are left alone, for the ones that were applied the file and line is
+// recorded as their source. Unknown keys do not stop the other entries from
+// being applied, they are returned as warnings.
+func (c *Config) Apply(fs *flag.FlagSet, sources map[string]string) (warnings []string, err error) {
+	applied := make(map[string]string)
+	for _, e := range c.Entries {
+		if fs.Lookup(e.Key) == nil {
+			warnings = append(warnings, fmt.Sprintf("%s:%d: unknown key %q", c.Path, e.Line, e.Key))
+			continue
+		}
+		if _, ok := sources[e.Key]; ok {
+			continue
+		}
+		for _, v := range e.Values {
+			if err := fs.Set(e.Key, v); err != nil {
+				return warnings, fmt.Errorf("%s:%d: invalid value for %s: %w", c.Path, e.Line, e.Key, err)
+			}
+		}
+		applied[e.Key] = fmt.Sprintf("%s:%d", c.Path, e.Line)
+	}
+	for key, source := range applied {
+		sources[key] = source
+	}
+
+	return warnings, nil
+}
@@ -0,0 +1,54 @@
+package archmirror
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigComments(t *testing.T) {
+	config, err := ParseConfig(strings.NewReader(`# archmirror
+[fetch]
+rank = "rate" # fastest
+country = ["DE", "FR"]   # close by
+out = /etc/pacman.d/mirrorlist#not a path
+; INI comment
+url = "https://example.org/#mirrorlist" # the # in quotes stays
+exec = 'echo "#1"' # and in literal strings
+user-agent = "a \" # b" # escaped quote
+include-from = ['a#b', "c"] # arrays too
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"rank":         {"rate"},
+		"country":      {"DE", "FR"},
+		"out":          {"/etc/pacman.d/mirrorlist"},
+		"url":          {"https://example.org/#mirrorlist"},
+		"exec":         {`echo "#1"`},
+		"user-agent":   {`a " # b`},
+		"include-from": {"a#b", "c"},
+	}
+	if len(config.Entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(config.Entries), len(want))
+	}
+	for _, e := range config.Entries {
+		if !slices.Equal(e.Values, want[e.Key]) {
+			t.Errorf("line %d: %s is %q, want %q", e.Line, e.Key, e.Values, want[e.Key])
+		}
+	}
+}
+
+func TestParseConfigInvalid(t *testing.T) {
+	for _, config := range []string{
+		"rank\n",
+		"= rate\n",
+		`country = ["DE" # unterminated` + "\n",
+		`rank = "rate # unterminated` + "\n",
+	} {
+		if _, err := ParseConfig(strings.NewReader(config)); err == nil {
+			t.Errorf("%q was accepted", config)
+		}
+	}
+}
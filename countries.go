@@ -0,0 +1,282 @@
+package archmirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A country as it is known to the mirrorlist generator
+type Country struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+var (
+	countrySelectRegexp = regexp.MustCompile(`(?s)<select[^>]*name="country"[^>]*>(.*?)</select>`)
+	countryOptionRegexp = regexp.MustCompile(`(?s)<option[^>]*value="([^"]*)"[^>]*>(.*?)</option>`)
+)
+
+// The countries that the mirrorlist generator offers
+var Countries = []Country{
+	{"AU", "Australia"},
+	{"AT", "Austria"},
+	{"AZ", "Azerbaijan"},
+	{"BD", "Bangladesh"},
+	{"BY", "Belarus"},
+	{"BE", "Belgium"},
+	{"BA", "Bosnia and Herzegovina"},
+	{"BR", "Brazil"},
+	{"BG", "Bulgaria"},
+	{"KH", "Cambodia"},
+	{"CA", "Canada"},
+	{"CL", "Chile"},
+	{"CN", "China"},
+	{"CO", "Colombia"},
+	{"HR", "Croatia"},
+	{"CZ", "Czechia"},
+	{"DK", "Denmark"},
+	{"EC", "Ecuador"},
+	{"EE", "Estonia"},
+	{"FI", "Finland"},
+	{"FR", "France"},
+	{"GE", "Georgia"},
+	{"DE", "Germany"},
+	{"GR", "Greece"},
+	{"HK", "Hong Kong"},
+	{"HU", "Hungary"},
+	{"IS", "Iceland"},
+	{"IN", "India"},
+	{"ID", "Indonesia"},
+	{"IR", "Iran"},
+	{"IL", "Israel"},
+	{"IT", "Italy"},
+	{"JP", "Japan"},
+	{"KZ", "Kazakhstan"},
+	{"KE", "Kenya"},
+	{"LV", "Latvia"},
+	{"LT", "Lithuania"},
+	{"LU", "Luxembourg"},
+	{"MU", "Mauritius"},
+	{"MX", "Mexico"},
+	{"MD", "Moldova"},
+	{"MC", "Monaco"},
+	{"NL", "Netherlands"},
+	{"NC", "New Caledonia"},
+	{"NZ", "New Zealand"},
+	{"MK", "North Macedonia"},
+	{"NO", "Norway"},
+	{"PY", "Paraguay"},
+	{"PL", "Poland"},
+	{"PT", "Portugal"},
+	{"RE", "Réunion"},
+	{"RO", "Romania"},
+	{"RU", "Russia"},
+	{"RS", "Serbia"},
+	{"SG", "Singapore"},
+	{"SK", "Slovakia"},
+	{"SI", "Slovenia"},
+	{"ZA", "South Africa"},
+	{"KR", "South Korea"},
+	{"ES", "Spain"},
+	{"SE", "Sweden"},
+	{"CH", "Switzerland"},
+	{"TW", "Taiwan"},
+	{"TH", "Thailand"},
+	{"TR", "Turkey"},
+	{"UA", "Ukraine"},
+	{"GB", "United Kingdom"},
+	{"US", "United States"},
+	{"UZ", "Uzbekistan"},
+	{"VN", "Vietnam"},
+}
+
+// Other names people commonly use for a country
+var countryAliases = map[string]string{
+	"usa":                      "US",
+	"united states of america": "US",
+	"america":                  "US",
+	"uk":                       "GB",
+	"great britain":            "GB",
+	"britain":                  "GB",
+	"england":                  "GB",
+	"czech republic":           "CZ",
+	"korea":                    "KR",
+	"republic of korea":        "KR",
+	"holland":                  "NL",
+	"the netherlands":          "NL",
+	"russian federation":       "RU",
+	"turkiye":                  "TR",
+	"türkiye":                  "TR",
+	"macedonia":                "MK",
+	"reunion":                  "RE",
+	"viet nam":                 "VN",
+	"bosnia":                   "BA",
+}
+
+// Translate a country name, alias or code into the code the generator expects
+func ResolveCountry(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	lower := strings.ToLower(name)
+
+	if lower == CountryAll {
+		return CountryAll, nil
+	}
+
+	for _, c := range Countries {
+		if strings.EqualFold(c.Code, name) || strings.ToLower(c.Name) == lower {
+			return c.Code, nil
+		}
+	}
+	if code, ok := countryAliases[lower]; ok {
+		return code, nil
+	}
+
+	// Something that looks like a country code is passed on as-is
+	if len(name) == 2 {
+		return strings.ToUpper(name), nil
+	}
+
+	matches := closeCountries(lower)
+	if len(matches) == 0 {
+		return "", fmt.Errorf("unknown country %q", name)
+	}
+	return "", fmt.Errorf("unknown country %q, did you mean: %s?", name, strings.Join(matches, ", "))
+}
+
+// Check whether the generator knows the country code
+func IsKnownCountry(code string) bool {
+	if code == CountryAll {
+		return true
+	}
+
+	for _, c := range Countries {
+		if c.Code == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Find the countries whose names are similar to name
+func closeCountries(name string) []string {
+	matches := make([]string, 0)
+	for _, c := range Countries {
+		lower := strings.ToLower(c.Name)
+		if strings.HasPrefix(lower, name) || levenshtein(lower, name) <= 2 {
+			matches = append(matches, fmt.Sprintf("%s (%s)", c.Name, c.Code))
+		}
+	}
+	sort.Strings(matches)
+
+	return matches
+}
+
+// Compute the edit distance between the strings a and b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(rb)]
+}
+
+// Extract the countries from the generator's HTML form, sorted by their code
+func ParseCountries(r io.Reader) ([]Country, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	sel := countrySelectRegexp.FindSubmatch(body)
+	if sel == nil {
+		return nil, errors.New("no country selection found in the generator page")
+	}
+
+	countries := make([]Country, 0)
+	for _, option := range countryOptionRegexp.FindAllSubmatch(sel[1], -1) {
+		code := html.UnescapeString(string(option[1]))
+		// "all" is not a country on its own
+		if code == "" || code == CountryAll {
+			continue
+		}
+
+		countries = append(countries, Country{
+			Code: code,
+			Name: strings.TrimSpace(html.UnescapeString(string(option[2]))),
+		})
+	}
+	if len(countries) == 0 {
+		return nil, errors.New("the generator page does not list any countries")
+	}
+
+	sort.Slice(countries, func(i, j int) bool {
+		return countries[i].Code < countries[j].Code
+	})
+
+	return countries, nil
+}
+
+// Fetch the countries that the generator currently offers
+func RequestCountries() ([]Country, error) {
+	return RequestCountriesContext(context.Background(), http.DefaultClient)
+}
+
+// Fetch the countries that the generator currently offers using client until
+// ctx is done
+func RequestCountriesContext(ctx context.Context, client *http.Client) ([]Country, error) {
+	return RequestCountriesFrom(ctx, client, ArchLinuxUrl)
+}
+
+// Fetch the countries that the generator at url offers
+func RequestCountriesFrom(ctx context.Context, client *http.Client, url string) ([]Country, error) {
+	req, err := newRequest(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, requestError(ctx, "requesting", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	// The countries are only on the HTML form
+	if err := checkContentType(resp.Header.Get("Content-Type"), "text/html"); err != nil {
+		return nil, fmt.Errorf("requesting %s: %w", finalURL(url, resp), err)
+	}
+
+	countries, err := ParseCountries(resp.Body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, requestError(ctx, "reading the countries from", url, err)
+		}
+		return nil, fmt.Errorf("reading the countries from %s: %w", url, err)
+	}
+
+	return countries, nil
+}
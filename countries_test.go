@@ -0,0 +1,90 @@
+package archmirror
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The countries in testdata/generator.html, sorted by their code
+var testCountries = []Country{
+	{"AT", "Austria"},
+	{"AU", "Australia"},
+	{"BA", "Bosnia and Herzegovina"},
+	{"DE", "Germany"},
+	{"HK", "Hong Kong"},
+	{"RE", "Réunion"},
+	{"US", "United States"},
+}
+
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestParseCountries(t *testing.T) {
+	countries, err := ParseCountries(strings.NewReader(readFixture(t, "generator.html")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(countries, testCountries) {
+		t.Errorf("got %v, want %v", countries, testCountries)
+	}
+}
+
+func TestParseCountriesWithoutCountries(t *testing.T) {
+	for _, page := range []string{
+		"<html><body>Down for maintenance</body></html>",
+		`<select name="protocol"><option value="https">https</option></select>`,
+		`<select name="country"><option value="all">All</option></select>`,
+	} {
+		if countries, err := ParseCountries(strings.NewReader(page)); err == nil {
+			t.Errorf("got %v from %q, want an error", countries, page)
+		}
+	}
+}
+
+func TestRequestCountriesFrom(t *testing.T) {
+	srv := testGenerator(t, http.StatusOK, "text/html; charset=utf-8", readFixture(t, "generator.html"))
+
+	countries, err := RequestCountriesFrom(context.Background(), srv.Client(), srv.URL+"/mirrorlist/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(countries, testCountries) {
+		t.Errorf("got %v, want %v", countries, testCountries)
+	}
+}
+
+func TestRequestCountriesFromFailure(t *testing.T) {
+	srv := testGenerator(t, http.StatusServiceUnavailable, "text/html", "<html>Service Unavailable</html>")
+
+	if countries, err := RequestCountriesFrom(context.Background(), srv.Client(), srv.URL+"/mirrorlist/"); err == nil {
+		t.Errorf("got %v from a failing generator, want an error", countries)
+	}
+}
+
+func TestRequestCountriesFromErrors(t *testing.T) {
+	text := testGenerator(t, http.StatusOK, "text/plain", readFixture(t, "generator.html"))
+	if _, err := RequestCountriesFrom(context.Background(), text.Client(), text.URL); err == nil {
+		t.Error("got the countries from a text file, want an error")
+	}
+
+	slow := slowMirror(t, 5*time.Second)
+	// A copy, the client of the server is shared
+	client := *slow.Client()
+	client.Timeout = 50 * time.Millisecond
+	_, err := RequestCountriesFrom(context.Background(), &client, slow.URL)
+	if !errors.Is(err, ErrRequestTimeout) {
+		t.Errorf("got %v from a client that timed out, want %v", err, ErrRequestTimeout)
+	}
+}
@@ -0,0 +1,99 @@
+package archmirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// A mirror has no address of the IP version its probes have to use
+type NoAddressError struct {
+	Host    string
+	Version IPVersion
+}
+
+func (e *NoAddressError) Error() string {
+	if e.Version == IPVersion6 {
+		return "no AAAA record for " + e.Host
+	}
+	return "no A record for " + e.Host
+}
+
+// Looks up the addresses of a host, *net.Resolver does
+type Resolver interface {
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+}
+
+// The networks of an IP version, for resolving and for dialing
+func (t IPVersion) networks() (ip, tcp string) {
+	if t == IPVersion6 {
+		return "ip6", "tcp6"
+	}
+	return "ip4", "tcp4"
+}
+
+// Whether the host has addresses of any IP version
+func hasAddresses(ctx context.Context, resolver Resolver, host string) bool {
+	ips, err := resolver.LookupIP(ctx, "ip", host)
+	return err == nil && len(ips) > 0
+}
+
+// The DialContext of an http.Transport that only connects over the IP
+// version, so that a mirror that cannot be reached over it fails its probe.
+// Hosts are resolved with resolver, net.DefaultResolver if nil. A host
+// without an address of the version fails with a *NoAddressError, one that
+// does not resolve at all with the error of the resolver.
+func DialIPVersion(version IPVersion, resolver Resolver) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	ipNetwork, tcpNetwork := version.networks()
+	dialer := &net.Dialer{KeepAlive: 30 * time.Second}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		var ips []net.IP
+		if ip := net.ParseIP(host); ip != nil {
+			if (ip.To4() != nil) != (version == IPVersion4) {
+				return nil, fmt.Errorf("%s is not an IPv%s address", host, version)
+			}
+			ips = []net.IP{ip}
+		} else {
+			ips, err = resolver.LookupIP(ctx, ipNetwork, host)
+			var dnsErr *net.DNSError
+			var addrErr *net.AddrError
+			switch {
+			// A host without addresses of the version looks just like one
+			// that does not exist at all, only the second is a resolution
+			// failure
+			case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+				if !hasAddresses(ctx, resolver, host) {
+					return nil, err
+				}
+				return nil, &NoAddressError{Host: host, Version: version}
+			// Hosts that only have addresses of the other version can also
+			// come back as an AddrError
+			case errors.As(err, &addrErr), err == nil && len(ips) == 0:
+				return nil, &NoAddressError{Host: host, Version: version}
+			case err != nil:
+				return nil, err
+			}
+		}
+
+		// Like the default dialer, try the addresses in turn
+		for _, ip := range ips {
+			var conn net.Conn
+			conn, err = dialer.DialContext(ctx, tcpNetwork, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
@@ -0,0 +1,94 @@
+package archmirror
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+// Answers lookups from a table of host and network
+type stubResolver map[string]func() ([]net.IP, error)
+
+func (r stubResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	if answer, ok := r[network+" "+host]; ok {
+		return answer()
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func answer(ips ...string) func() ([]net.IP, error) {
+	return func() ([]net.IP, error) {
+		parsed := make([]net.IP, 0, len(ips))
+		for _, ip := range ips {
+			parsed = append(parsed, net.ParseIP(ip))
+		}
+		return parsed, nil
+	}
+}
+
+func TestDialIPVersion(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	resolver := stubResolver{
+		"ip4 mirror.example": answer("127.0.0.1"),
+		"ip mirror.example":  answer("127.0.0.1"),
+		"ip6 v6.example":     answer("::1"),
+		"ip v6.example":      answer("::1"),
+		"ip4 v6.example": func() ([]net.IP, error) {
+			return nil, &net.DNSError{Err: "no such host", Name: "v6.example", IsNotFound: true}
+		},
+		"ip4 addr.example": func() ([]net.IP, error) {
+			return nil, &net.AddrError{Err: "no suitable address found", Addr: "addr.example"}
+		},
+		"ip4 empty.example": answer(),
+		"ip4 broken.example": func() ([]net.IP, error) {
+			return nil, &net.DNSError{Err: "server misbehaving", Name: "broken.example", IsTemporary: true}
+		},
+	}
+	dial := DialIPVersion(IPVersion4, resolver)
+
+	conn, err := dial(context.Background(), "tcp", net.JoinHostPort("mirror.example", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	for _, host := range []string{"v6.example", "addr.example", "empty.example"} {
+		var noAddr *NoAddressError
+		_, err := dial(context.Background(), "tcp", net.JoinHostPort(host, port))
+		if !errors.As(err, &noAddr) || noAddr.Host != host || noAddr.Version != IPVersion4 {
+			t.Errorf("%s: got %v, want a *NoAddressError", host, err)
+		}
+	}
+
+	for _, host := range []string{"nxdomain.example", "broken.example"} {
+		var noAddr *NoAddressError
+		var dnsErr *net.DNSError
+		_, err := dial(context.Background(), "tcp", net.JoinHostPort(host, port))
+		if errors.As(err, &noAddr) || !errors.As(err, &dnsErr) {
+			t.Errorf("%s: got %v, want the resolution failure", host, err)
+		}
+	}
+}
+
+func TestDialIPVersionLiteral(t *testing.T) {
+	dial := DialIPVersion(IPVersion6, stubResolver{})
+	if _, err := dial(context.Background(), "tcp", "127.0.0.1:80"); err == nil {
+		t.Error("dialed an IPv4 address over IPv6")
+	}
+}
@@ -0,0 +1,155 @@
+package archmirror
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A mirror that is in both lists, but at a different place
+type MovedMirror struct {
+	URL string
+	// The positions among the active mirrors, starting at 1
+	From, To int
+}
+
+// What changed between two mirrorlists. Only the active mirrors are compared
+// as the rest of the file does not matter to pacman.
+type MirrorlistDiff struct {
+	Added   []string
+	Removed []string
+	Moved   []MovedMirror
+}
+
+// Whether both lists contain the same active mirrors in the same order
+func (d *MirrorlistDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Moved) == 0
+}
+
+// Print the changes in the style of a unified diff
+func (d *MirrorlistDiff) Write(w io.Writer, oldName, newName string) error {
+	lines := []string{"--- " + oldName, "+++ " + newName}
+	for _, url := range d.Removed {
+		lines = append(lines, "-Server = "+url)
+	}
+	for _, url := range d.Added {
+		lines = append(lines, "+Server = "+url)
+	}
+	for _, m := range d.Moved {
+		lines = append(lines, fmt.Sprintf("~Server = %s (%d -> %d)", m.URL, m.From, m.To))
+	}
+
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// The URLs of the active mirrors, without the whitespace around them. Only
+// the first of duplicate entries counts, just like for pacman.
+func activeURLs(l *Mirrorlist) []string {
+	urls := make([]string, 0, len(l.Mirrors))
+	seen := make(map[string]bool, len(l.Mirrors))
+	for _, m := range l.Mirrors {
+		url := strings.TrimSpace(m.URL)
+		if m.Active && !seen[url] {
+			urls = append(urls, url)
+			seen[url] = true
+		}
+	}
+
+	return urls
+}
+
+// Compare the active mirrors of two lists. Mirrors in both lists that are
+// not part of the longest common ordering are reported as moved.
+func DiffMirrorlists(before, after *Mirrorlist) *MirrorlistDiff {
+	oldURLs, newURLs := activeURLs(before), activeURLs(after)
+	oldIndex := make(map[string]int, len(oldURLs))
+	for i, url := range oldURLs {
+		oldIndex[url] = i
+	}
+	newIndex := make(map[string]int, len(newURLs))
+	for i, url := range newURLs {
+		newIndex[url] = i
+	}
+
+	diff := &MirrorlistDiff{}
+	oldCommon := make([]string, 0)
+	for _, url := range oldURLs {
+		if _, ok := newIndex[url]; ok {
+			oldCommon = append(oldCommon, url)
+		} else {
+			diff.Removed = append(diff.Removed, url)
+		}
+	}
+	newCommon := make([]string, 0)
+	for _, url := range newURLs {
+		if _, ok := oldIndex[url]; ok {
+			newCommon = append(newCommon, url)
+		} else {
+			diff.Added = append(diff.Added, url)
+		}
+	}
+
+	// Both lists hold the same mirrors now, find the longest common
+	// subsequence of them
+	n := len(oldCommon)
+	lengths := make([][]int, n+1)
+	for i := range lengths {
+		lengths[i] = make([]int, n+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := n - 1; j >= 0; j-- {
+			if oldCommon[i] == newCommon[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+	inOrder := make(map[string]bool, n)
+	for i, j := 0, 0; i < n && j < n; {
+		switch {
+		case oldCommon[i] == newCommon[j]:
+			inOrder[oldCommon[i]] = true
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	for _, url := range newCommon {
+		if !inOrder[url] {
+			diff.Moved = append(diff.Moved, MovedMirror{URL: url, From: oldIndex[url] + 1, To: newIndex[url] + 1})
+		}
+	}
+
+	return diff
+}
+
+// Whether the two pacman mirrorlists agree on everything but their headers.
+// The header is the comment block in front of the first mirror and the notes
+// written by Render, both of which contain the time the list was generated.
+func SameMirrorlistBody(a, b []byte) (bool, error) {
+	body := func(data []byte) (string, error) {
+		l, err := ParseMirrorlist(bytes.NewReader(data))
+		if err != nil {
+			return "", err
+		}
+		l.Header, l.Notes = nil, nil
+		return l.Render(), nil
+	}
+
+	bodyA, err := body(a)
+	if err != nil {
+		return false, err
+	}
+	bodyB, err := body(b)
+	if err != nil {
+		return false, err
+	}
+
+	return bodyA == bodyB, nil
+}
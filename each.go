@@ -0,0 +1,108 @@
+package archmirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// How many countries are requested at the same time by default
+const DefaultCountryThreads = 3
+
+// The mirrors of a country could not be requested
+type CountryError struct {
+	Country string
+	Err     error
+}
+
+func (e *CountryError) Error() string {
+	return fmt.Sprintf("country %s: %v", e.Country, e.Err)
+}
+
+func (e *CountryError) Unwrap() error {
+	return e.Err
+}
+
+// Whether the countries of c can be requested one by one
+func (c *MirrorListConfig) SplitsByCountry() bool {
+	if len(c.Countries) < 2 {
+		return false
+	}
+	for _, name := range c.Countries {
+		if code, err := ResolveCountry(name); err == nil && code == CountryAll {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Request the list of every country of c on its own using request, at most
+// threads at a time. The lists are joined in the order of c.Countries, so the
+// result does not depend on which answer came first. The countries that
+// failed are returned, unless strict is set they do not stop the others. The
+// list is nil if no country worked.
+func RequestEachCountry(ctx context.Context, c *MirrorListConfig, threads int, strict bool, request func(context.Context, *MirrorListConfig) (*Mirrorlist, error)) (*Mirrorlist, []*CountryError) {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lists := make([]*Mirrorlist, len(c.Countries))
+	errs := make([]*CountryError, len(c.Countries))
+	sem := make(chan struct{}, max(threads, 1))
+	var wg sync.WaitGroup
+	for i, country := range c.Countries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			// A failed country in strict mode makes the others pointless
+			if ctx.Err() != nil {
+				errs[i] = &CountryError{country, ctx.Err()}
+				return
+			}
+
+			single := *c
+			single.Countries = []string{country}
+			list, err := request(ctx, &single)
+			if err != nil {
+				errs[i] = &CountryError{country, err}
+				if strict {
+					cancel()
+				}
+				return
+			}
+			lists[i] = list
+		}()
+	}
+	wg.Wait()
+
+	var joined *Mirrorlist
+	failed := make([]*CountryError, 0)
+	for i, list := range lists {
+		if list == nil {
+			// Only report the country that stopped the others
+			if parent.Err() != nil || !errors.Is(errs[i].Err, context.Canceled) {
+				failed = append(failed, errs[i])
+			}
+			continue
+		}
+		if joined == nil {
+			joined = &Mirrorlist{Header: list.Header, Generated: list.Generated, FromCache: true}
+		}
+		joined.Mirrors = append(joined.Mirrors, list.Mirrors...)
+		joined.Footer = list.Footer
+		if list.Generated.Before(joined.Generated) {
+			joined.Generated = list.Generated
+		}
+		joined.FromCache = joined.FromCache && list.FromCache
+	}
+	if joined != nil {
+		// Mirrors in more than one country are kept in the first
+		joined.RemoveDuplicates()
+	}
+
+	return joined, failed
+}
@@ -0,0 +1,48 @@
+package archmirror
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The client gave up on a request because it took too long
+var ErrRequestTimeout = errors.New("deadline exceeded")
+
+// The generator answered with something other than a text file
+var ErrNotPlaintext = errors.New("expected plaintext")
+
+// A mirror status API answered with something other than JSON
+var ErrNotJSON = errors.New("expected JSON")
+
+// The generator answered with an HTML page, usually because it did not like
+// the parameters
+var ErrHTMLResponse = errors.New("got an HTML page instead of a mirrorlist, check the country parameter")
+
+// The generator sent a list without a single mirror
+var ErrEmptyMirrorlist = errors.New("mirrorlist does not contain any mirrors")
+
+// A server answered with a status other than 200 OK
+type StatusError struct {
+	URL  string
+	Code int
+	// The status line, e.g. "404 Not Found"
+	Status string
+	// The start of the body, error pages often explain what went wrong
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("requesting %s: %s", e.URL, e.Status)
+	}
+	return fmt.Sprintf("requesting %s: %s: %q", e.URL, e.Status, e.Body)
+}
+
+// A list has fewer active mirrors than required
+type TooFewMirrorsError struct {
+	Active, Min int
+}
+
+func (e *TooFewMirrorsError) Error() string {
+	return fmt.Sprintf("only %d active mirrors are left, at least %d are required", e.Active, e.Min)
+}
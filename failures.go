@@ -0,0 +1,113 @@
+package archmirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// How long a failed mirror is skipped by default
+const DefaultFailureExpiry = 24 * time.Hour
+
+// Remembers which mirrors failed their probes in previous runs
+type FailureCache struct {
+	path string
+	// When each mirror URL last failed
+	Failures map[string]time.Time `json:"failures"`
+}
+
+// The default location of the failure cache, honoring $XDG_CACHE_HOME
+func DefaultFailureCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "archmirror", "failures.json"), nil
+}
+
+// Create an empty failure cache that is saved to path
+func NewFailureCache(path string) *FailureCache {
+	return &FailureCache{path: path, Failures: make(map[string]time.Time)}
+}
+
+// Load the failure cache from path. A missing file results in an empty cache.
+func LoadFailureCache(path string) (*FailureCache, error) {
+	cache := NewFailureCache(path)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cache, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, cache); err != nil {
+		return nil, err
+	}
+	if cache.Failures == nil {
+		cache.Failures = make(map[string]time.Time)
+	}
+
+	return cache, nil
+}
+
+// Forget failures that are older than expiry
+func (c *FailureCache) Expire(expiry time.Duration, now time.Time) {
+	for url, t := range c.Failures {
+		if now.Sub(t) > expiry {
+			delete(c.Failures, url)
+		}
+	}
+}
+
+// Whether the mirror failed within the expiry period
+func (c *FailureCache) Failed(m *Mirror) bool {
+	_, ok := c.Failures[m.URL]
+	return ok
+}
+
+// Remember the mirrors that failed and forget the ones that answered
+func (c *FailureCache) Record(results []ProbeResult, now time.Time) {
+	for _, r := range results {
+		// Being interrupted, running out of time as a whole or a broken
+		// proxy is not the mirror's fault, and an old mirror may have synced
+		// by the next run
+		if errors.Is(r.Err, context.Canceled) || errors.Is(r.Err, context.DeadlineExceeded) || errors.Is(r.Err, ErrProxyUnreachable) || errors.Is(r.Err, ErrOutOfSync) || errors.Is(r.Err, ErrSyncUnknown) || errors.Is(r.Err, ErrTestFileMissing) {
+			continue
+		}
+		if r.Err != nil {
+			c.Failures[r.Mirror.URL] = now
+		} else {
+			delete(c.Failures, r.Mirror.URL)
+		}
+	}
+}
+
+// Atomically write the cache back to disk
+func (c *FailureCache) Save() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(c.path, data, true)
+}
+
+// Remove the cache file
+func ClearFailureCache(path string) error {
+	err := os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
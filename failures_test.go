@@ -0,0 +1,61 @@
+package archmirror
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// A mirror that takes delay to answer anything
+func slowMirror(t *testing.T, delay time.Duration) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func rankWithFailures(t *testing.T, ctx context.Context, l *Mirrorlist, timeout time.Duration) *FailureCache {
+	t.Helper()
+	summary := Rank(ctx, l, RankOptions{Mode: RankLatency, Timeout: timeout, Threads: 1})
+	cache := NewFailureCache(filepath.Join(t.TempDir(), "failures.json"))
+	cache.Record(summary.Results, time.Now())
+	return cache
+}
+
+func TestRecordSkipsTheEndOfTheRun(t *testing.T) {
+	srv := slowMirror(t, 5*time.Second)
+	// The first one is cut off, the second one is never probed
+	l := testList("Germany", srv.URL+"/a/$repo/os/$arch", srv.URL+"/b/$repo/os/$arch")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	cache := rankWithFailures(t, ctx, l, 2*time.Second)
+	if len(cache.Failures) != 0 {
+		t.Errorf("recorded %v, but the deadline of the run is not the fault of the mirrors", cache.Failures)
+	}
+}
+
+func TestRecordKeepsProbeTimeouts(t *testing.T) {
+	srv := slowMirror(t, 5*time.Second)
+	url := srv.URL + "/$repo/os/$arch"
+	l := testList("Germany", url)
+
+	summary := Rank(context.Background(), l, RankOptions{Mode: RankLatency, Timeout: 50 * time.Millisecond, Threads: 1})
+	if err := summary.Results[0].Err; !errors.Is(err, ErrProbeTimeout) {
+		t.Fatalf("the probe failed with %v, want %v", err, ErrProbeTimeout)
+	}
+	cache := NewFailureCache(filepath.Join(t.TempDir(), "failures.json"))
+	cache.Record(summary.Results, time.Now())
+	if !cache.Failed(&Mirror{URL: url}) {
+		t.Error("a mirror that timed out on its own was not recorded")
+	}
+}
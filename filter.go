@@ -0,0 +1,139 @@
+package archmirror
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Decides which mirrors are kept in the list
+type Filter struct {
+	// What the filter checks, e.g. "completion >= 100%"
+	Description string
+	Keep        func(m *Mirror) bool
+	// Describes why a mirror was removed, may be nil
+	Detail func(m *Mirror) string
+}
+
+// The mirrors that a filter removed
+type FilterResult struct {
+	Filter  *Filter
+	Removed []Mirror
+}
+
+// Remove the mirrors that do not pass all filters. The filters are applied
+// one after another so each mirror is only attributed to the first filter
+// that removed it.
+func ApplyFilters(l *Mirrorlist, filters []Filter) []FilterResult {
+	results := make([]FilterResult, 0, len(filters))
+	for i := range filters {
+		f := &filters[i]
+		result := FilterResult{Filter: f}
+
+		mirrors := make([]Mirror, 0, len(l.Mirrors))
+		for _, m := range l.Mirrors {
+			if f.Keep(&m) {
+				mirrors = append(mirrors, m)
+			} else {
+				result.Removed = append(result.Removed, m)
+			}
+		}
+
+		l.Mirrors = mirrors
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// Only keep mirrors that passed at least percent of the archlinux.org checks.
+// Mirrors without a status are only kept if keepUnknown is set.
+func CompletionFilter(percent float64, keepUnknown bool) Filter {
+	return Filter{
+		Description: fmt.Sprintf("completion >= %g%%", percent),
+		Keep: func(m *Mirror) bool {
+			if m.Status == nil {
+				return keepUnknown
+			}
+			return m.Status.CompletionPct*100 >= percent
+		},
+	}
+}
+
+// Only keep mirrors that synced at most maxAge before the archlinux.org
+// checks ran at checked. Mirrors that never synced are removed, mirrors
+// without a status are only kept if keepUnknown is set.
+func AgeFilter(maxAge time.Duration, checked time.Time, keepUnknown bool) Filter {
+	return Filter{
+		Description: fmt.Sprintf("age <= %s", maxAge),
+		Keep: func(m *Mirror) bool {
+			if m.Status == nil {
+				return keepUnknown
+			}
+			return m.Status.LastSync != nil && checked.Sub(*m.Status.LastSync) <= maxAge
+		},
+		Detail: func(m *Mirror) string {
+			switch {
+			case m.Status == nil:
+				return "no status"
+			case m.Status.LastSync == nil:
+				return "never synced"
+			}
+			return "age " + checked.Sub(*m.Status.LastSync).Round(time.Minute).String()
+		},
+	}
+}
+
+// Only keep mirrors that are at most maxDelay behind the master. Mirrors
+// whose delay is unknown are only kept if keepUnknown is set.
+func DelayFilter(maxDelay time.Duration, keepUnknown bool) Filter {
+	return Filter{
+		Description: fmt.Sprintf("delay <= %s", maxDelay),
+		Keep: func(m *Mirror) bool {
+			if m.Status == nil || m.Status.Delay == nil {
+				return keepUnknown
+			}
+			return time.Duration(*m.Status.Delay)*time.Second <= maxDelay
+		},
+		Detail: func(m *Mirror) string {
+			if m.Status == nil || m.Status.Delay == nil {
+				return "unknown delay"
+			}
+			return "delay " + (time.Duration(*m.Status.Delay) * time.Second).String()
+		},
+	}
+}
+
+// Remove mirrors whose URL or hostname matches one of the patterns
+func ExcludeFilter(patterns []*regexp.Regexp) Filter {
+	quoted := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		quoted = append(quoted, fmt.Sprintf("%q", p.String()))
+	}
+
+	// The pattern that the mirror matches, nil if none
+	match := func(m *Mirror) *regexp.Regexp {
+		host := ""
+		if u, err := url.Parse(m.URL); err == nil {
+			host = u.Hostname()
+		}
+		for _, p := range patterns {
+			if p.MatchString(m.URL) || (host != "" && p.MatchString(host)) {
+				return p
+			}
+		}
+		return nil
+	}
+
+	return Filter{
+		Description: "exclude " + strings.Join(quoted, ", "),
+		Keep: func(m *Mirror) bool {
+			return match(m) == nil
+		},
+		Detail: func(m *Mirror) string {
+			return fmt.Sprintf("matches %q", match(m).String())
+		},
+	}
+}
@@ -0,0 +1,116 @@
+package archmirror
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// A distribution whose mirrors archmirror knows how to find. The rest of the
+// package only works on the Mirrorlist, so new distributions only need a
+// Flavor.
+type Flavor interface {
+	// The name as used by -flavor
+	Name() string
+	// Where the mirrors for the configuration are requested from
+	Source(c *MirrorListConfig) (string, error)
+	// Fetch the mirrors matching the configuration. The mirrors are
+	// activated unless c.KeepCommented is set.
+	RequestMirrorList(ctx context.Context, client *http.Client, c *MirrorListConfig) (*Mirrorlist, error)
+	// What is downloaded from the mirrors when ranking them
+	ProbeTarget() ProbeTarget
+	// The architectures the mirrors carry, the one of ProbeTarget first
+	Arches() []string
+	// What every Server line ends with, e.g. "/$repo/os/$arch"
+	ServerSuffix() string
+}
+
+// The supported distributions
+var Flavors = map[string]Flavor{
+	"arch":    ArchFlavor{},
+	"alarm":   ALARMFlavor{},
+	"manjaro": ManjaroFlavor{},
+}
+
+// The names of all flavors
+func FlavorNames() []string {
+	names := make([]string, 0, len(Flavors))
+	for name := range Flavors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Look up a flavor by its name
+func GetFlavor(name string) (Flavor, error) {
+	flavor, ok := Flavors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown flavor %q, expected one of %s", name, strings.Join(FlavorNames(), ", "))
+	}
+
+	return flavor, nil
+}
+
+// Arch Linux, whose mirrorlist generator does all the work
+type ArchFlavor struct{}
+
+func (ArchFlavor) Name() string {
+	return "arch"
+}
+
+func (ArchFlavor) Source(c *MirrorListConfig) (string, error) {
+	return c.URL()
+}
+
+func (ArchFlavor) RequestMirrorList(ctx context.Context, client *http.Client, c *MirrorListConfig) (*Mirrorlist, error) {
+	return RequestMirrorListContext(ctx, client, c)
+}
+
+func (ArchFlavor) ProbeTarget() ProbeTarget {
+	return ArchProbeTarget
+}
+
+func (ArchFlavor) Arches() []string {
+	return []string{"x86_64"}
+}
+
+func (ArchFlavor) ServerSuffix() string {
+	return "/$repo/os/$arch"
+}
+
+// Remove the mirrors that are not in one of the configured countries or use
+// a protocol that was not asked for. Sections that are not a country are only
+// kept for CountryAll.
+func (c *MirrorListConfig) filterList(l *Mirrorlist) error {
+	countries := make(map[string]bool)
+	for _, name := range c.Countries {
+		code, err := ResolveCountry(name)
+		if err != nil {
+			return err
+		}
+		countries[code] = true
+	}
+	protocols := make(map[ProtocolType]bool)
+	for _, p := range c.Protocols {
+		protocols[p] = true
+	}
+
+	mirrors := make([]Mirror, 0, len(l.Mirrors))
+	for _, m := range l.Mirrors {
+		code, err := ResolveCountry(m.Country)
+		if !countries[CountryAll] && (err != nil || !countries[code]) {
+			continue
+		}
+		if !protocols[m.Protocol] {
+			continue
+		}
+		mirrors = append(mirrors, m)
+	}
+	l.Mirrors = mirrors
+
+	return nil
+}
@@ -0,0 +1,3 @@
+module github.com/PapaTutuWawa/archmirror
+
+go 1.24
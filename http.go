@@ -0,0 +1,129 @@
+package archmirror
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/PapaTutuWawa/archmirror/internal/version"
+)
+
+// The User-Agent sent with every request
+var UserAgent = "archmirror/" + version.Version()
+
+// The version of the package as recorded by the Go toolchain
+func Version() string {
+	return version.Version()
+}
+
+// We could not even talk to the proxy
+var ErrProxyUnreachable = errors.New("cannot connect to the proxy")
+
+// Tell failures to reach the proxy apart from failures of the server behind
+// it. Returns nil if err has nothing to do with the proxy.
+func proxyError(err error) error {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "proxyconnect" {
+		return fmt.Errorf("%w: %v", ErrProxyUnreachable, opErr.Err)
+	}
+
+	return nil
+}
+
+// How many redirects a request to archlinux.org may go through
+const MaxRedirects = 5
+
+// A request was redirected more often than allowed
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// The CheckRedirect of an http.Client that follows at most max redirects and
+// logs every one. With max 0 the redirect is returned as the response.
+func RedirectPolicy(max int) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if max == 0 {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > max {
+			chain := make([]string, 0, len(via))
+			for _, r := range via[1:] {
+				chain = append(chain, r.URL.String())
+			}
+			chain = append(chain, req.URL.String())
+			return fmt.Errorf("%w (more than %d) through %s", ErrTooManyRedirects, max, strings.Join(chain, " -> "))
+		}
+
+		status := ""
+		if req.Response != nil {
+			status = req.Response.Status
+		}
+		loggerFrom(req.Context()).Debug("Following a redirect", "from", via[len(via)-1].URL.String(), "to", req.URL.String(), "status", status)
+		return nil
+	}
+}
+
+// The URL a request went to, with the one it ended up at if it was
+// redirected
+func finalURL(url string, resp *http.Response) string {
+	if final := resp.Request.URL.String(); final != url {
+		return url + " (redirected to " + final + ")"
+	}
+	return url
+}
+
+// Create a GET request for url that is aborted once ctx is done
+func newRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+
+	return req, nil
+}
+
+// A gzip compressed response body
+type gzipBody struct {
+	zr   *gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	n, err := b.zr.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("decoding the gzip response: %w", err)
+	}
+	return n, err
+}
+
+func (b *gzipBody) Close() error {
+	b.zr.Close()
+	return b.body.Close()
+}
+
+// Replace the body of the response by its decoded content. As we ask for
+// gzip ourselves, the transport leaves the decoding to us.
+func decodeBody(resp *http.Response) error {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "", "identity":
+		return nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return fmt.Errorf("decoding the gzip response: %w", err)
+		}
+		resp.Body = &gzipBody{zr: zr, body: resp.Body}
+		// The lengths were about the compressed data
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		return nil
+	}
+
+	return fmt.Errorf("unsupported Content-Encoding %q", encoding)
+}
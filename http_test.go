@@ -0,0 +1,80 @@
+package archmirror
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// A generator that sends body as it is, claiming it to be gzip compressed
+func gzipGenerator(t *testing.T, body []byte) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			t.Errorf("the request did not accept gzip, but %q", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRequestMirrorListGzip(t *testing.T) {
+	srv := gzipGenerator(t, gzipped(t, testMirrorlist))
+
+	list, err := RequestMirrorListWithClient(srv.Client(), testConfig(srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := mustParse(t, testMirrorlist)
+	want.Activate()
+	if !reflect.DeepEqual(list.Mirrors, want.Mirrors) {
+		t.Errorf("got %v, want %v", list.Mirrors, want.Mirrors)
+	}
+}
+
+func TestRequestMirrorListCorruptGzip(t *testing.T) {
+	// The checksum at the end does not match
+	badChecksum := gzipped(t, testMirrorlist)
+	badChecksum[len(badChecksum)-8] ^= 0xff
+
+	for _, tc := range []struct {
+		name string
+		body []byte
+		want error
+	}{
+		{"not gzip at all", []byte(testMirrorlist), gzip.ErrHeader},
+		{"wrong checksum", badChecksum, gzip.ErrChecksum},
+	} {
+		srv := gzipGenerator(t, tc.body)
+
+		list, err := RequestMirrorListWithClient(srv.Client(), testConfig(srv))
+		if err == nil {
+			t.Errorf("%s: got %d mirrors, want an error", tc.name, len(list.Mirrors))
+			continue
+		}
+		if !errors.Is(err, tc.want) || !strings.Contains(err.Error(), "decoding the gzip response") {
+			t.Errorf("%s: got %v, want a decode error wrapping %v", tc.name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package archmirror
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Check that an entry of an include list can match a mirror at all
+func checkIncludeEntry(entry string) error {
+	if strings.ContainsFunc(entry, unicode.IsSpace) {
+		return errors.New("expected a single hostname or URL prefix")
+	}
+	if strings.Contains(entry, "://") {
+		if u, err := url.Parse(entry); err != nil || u.Host == "" {
+			return fmt.Errorf("%q is not an URL prefix", entry)
+		}
+	} else if strings.Contains(entry, "/") {
+		// Only URL prefixes can have a path
+		return fmt.Errorf("%q is neither a hostname nor an URL prefix", entry)
+	}
+
+	return nil
+}
+
+// Read a list of allowed mirrors. Each line contains a hostname or an URL
+// prefix, everything after a # is a comment.
+func ParseIncludeList(r io.Reader) ([]string, error) {
+	entries := make([]string, 0)
+	scanner := bufio.NewScanner(skipBOM(r))
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if err := checkIncludeEntry(line); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		entries = append(entries, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Read the list of allowed mirrors from a file
+func ReadIncludeList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries, err := ParseIncludeList(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return entries, nil
+}
+
+// Whether the mirror matches an entry of an include list
+func matchesInclude(m *Mirror, entries []string) bool {
+	host := ""
+	if u, err := url.Parse(m.URL); err == nil {
+		host = u.Hostname()
+	}
+
+	for _, entry := range entries {
+		if strings.Contains(entry, "://") {
+			if strings.HasPrefix(strings.ToLower(m.URL), strings.ToLower(entry)) {
+				return true
+			}
+		} else if host != "" && strings.EqualFold(host, entry) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Only keep the mirrors that match one of the entries
+func IncludeFilter(entries []string) Filter {
+	return Filter{
+		Description: "include list",
+		Keep: func(m *Mirror) bool {
+			return matchesInclude(m, entries)
+		},
+	}
+}
@@ -0,0 +1,92 @@
+package archmirror
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseIncludeList(t *testing.T) {
+	list := "\ufeff# The mirrors our proxy lets through\n" +
+		"\n" +
+		"mirror.example.org\n" +
+		"   https://mirror.example.com/archlinux/   # with a path\n" +
+		"\t\n" +
+		"#mirror.example.net\n" +
+		"MIRROR.EXAMPLE.EDU\r\n"
+
+	entries, err := ParseIncludeList(strings.NewReader(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"mirror.example.org", "https://mirror.example.com/archlinux/", "MIRROR.EXAMPLE.EDU"}
+	if !slices.Equal(entries, want) {
+		t.Errorf("got %q, want %q", entries, want)
+	}
+}
+
+func TestParseIncludeListOnlyComments(t *testing.T) {
+	entries, err := ParseIncludeList(strings.NewReader("# nothing yet\n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("got %q, want no entries", entries)
+	}
+}
+
+func TestParseIncludeListBadLines(t *testing.T) {
+	for _, tc := range []struct {
+		list string
+		line string
+	}{
+		{"mirror.example.org\nServer = https://mirror.example.com/$repo/os/$arch\n", "line 2:"},
+		{"mirror.example.org another.example.org\n", "line 1:"},
+		{"# comment\nhttps:///archlinux/\n", "line 2:"},
+		{"\n\nmirror.example.org/archlinux\n", "line 3:"},
+	} {
+		entries, err := ParseIncludeList(strings.NewReader(tc.list))
+		if err == nil {
+			t.Errorf("got %q from %q, want an error", entries, tc.list)
+		} else if !strings.HasPrefix(err.Error(), tc.line) {
+			t.Errorf("got %q for %q, want it to start with %q", err, tc.list, tc.line)
+		}
+	}
+}
+
+func TestReadIncludeList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "include")
+	if err := os.WriteFile(path, []byte("a b\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadIncludeList(path); err == nil || !strings.HasPrefix(err.Error(), path+": line 1:") {
+		t.Errorf("got %v, want the path and line of the bad entry", err)
+	}
+
+	var pathErr *fs.PathError
+	if _, err := ReadIncludeList(path + ".missing"); !errors.As(err, &pathErr) {
+		t.Errorf("got %v for a missing file, want a *fs.PathError", err)
+	}
+}
+
+func TestIncludeFilter(t *testing.T) {
+	l := testList("Germany",
+		"https://mirror.example.org/$repo/os/$arch",
+		"https://mirror.example.com/archlinux/$repo/os/$arch",
+		"https://mirror.example.com/other/$repo/os/$arch",
+		"http://MIRROR.EXAMPLE.EDU/$repo/os/$arch",
+		"https://sub.mirror.example.org/$repo/os/$arch",
+	)
+	keep := IncludeFilter([]string{"mirror.example.org", "HTTPS://mirror.example.com/archlinux/", "mirror.example.edu"}).Keep
+
+	want := []bool{true, true, false, true, false}
+	for i, m := range l.Mirrors {
+		if got := keep(&m); got != want[i] {
+			t.Errorf("%s: got %t, want %t", m.URL, got, want[i])
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Package desktop shows desktop notifications with notify-send. Without a
+// session bus or notify-send everything is a no-op.
+package desktop
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// How much attention a notification asks for
+type Urgency string
+
+const (
+	Normal   Urgency = "normal"
+	Critical Urgency = "critical"
+)
+
+// notify-send should return right away, but a hanging notification daemon
+// must not hold up a refresh
+const sendTimeout = 5 * time.Second
+
+// Whether there is a session bus that notifications can be sent to
+func sessionBus() bool {
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") != "" {
+		return true
+	}
+	// systemd user sessions put the bus here without setting the variable
+	runtime := os.Getenv("XDG_RUNTIME_DIR")
+	if runtime == "" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(runtime, "bus"))
+	return err == nil
+}
+
+// Show a notification with the summary as its title. Does nothing if there is
+// no session bus or notify-send is not installed.
+func Notify(ctx context.Context, urgency Urgency, summary, body string) error {
+	if !sessionBus() {
+		return nil
+	}
+	path, err := exec.LookPath("notify-send")
+	if err != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	return exec.CommandContext(ctx, path, "--app-name=archmirror", "--urgency="+string(urgency), summary, body).Run()
+}
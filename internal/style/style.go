@@ -0,0 +1,64 @@
+// Package style colors the messages printed to a terminal with ANSI escape
+// sequences. With colors off everything is returned as it is.
+package style
+
+import (
+	"fmt"
+	"os"
+)
+
+// The values of -color
+var Modes = []string{"auto", "always", "never"}
+
+// Whether mode asks for colors. auto means on a terminal unless NO_COLOR is
+// set, see https://no-color.org.
+func Enabled(mode string, terminal bool) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		return terminal && os.Getenv("NO_COLOR") == "", nil
+	}
+
+	return false, fmt.Errorf("unknown color mode %q", mode)
+}
+
+const (
+	reset  = "\033[0m"
+	bold   = "\033[1m"
+	red    = "\033[31m"
+	yellow = "\033[33m"
+)
+
+// Styles text, or leaves it alone if colors are off
+type Style struct {
+	color bool
+}
+
+func New(color bool) Style {
+	return Style{color}
+}
+
+func (s Style) wrap(code, text string) string {
+	if !s.color || text == "" {
+		return text
+	}
+	return code + text + reset
+}
+
+// Red for errors
+func (s Style) Error(text string) string {
+	return s.wrap(red, text)
+}
+
+// Yellow for warnings
+func (s Style) Warning(text string) string {
+	return s.wrap(yellow, text)
+}
+
+// Bold for what matters most
+func (s Style) Bold(text string) string {
+	return s.wrap(bold, text)
+}
@@ -0,0 +1,101 @@
+// Package version tells which build of archmirror is running. It is taken
+// from the build info the Go toolchain records, and can be set when building
+// a release:
+//
+//	go build -ldflags "-X github.com/PapaTutuWawa/archmirror/internal/version.version=v1.2.0
+//	    -X github.com/PapaTutuWawa/archmirror/internal/version.commit=abc1234
+//	    -X github.com/PapaTutuWawa/archmirror/internal/version.date=2024-05-01T12:00:00Z"
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// The path of the module, used to find its version in the build info
+const modulePath = "github.com/PapaTutuWawa/archmirror"
+
+// Set with -ldflags -X, they win over the build info
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// A build setting of the main module, e.g. vcs.revision
+func setting(key string) string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, s := range info.Settings {
+		if s.Key == key {
+			return s.Value
+		}
+	}
+
+	return ""
+}
+
+// The semantic version, "unknown" if nobody recorded it
+func Version() string {
+	if version != "" {
+		return version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	v := info.Main.Version
+	if info.Main.Path != modulePath {
+		// We are being used as a library
+		v = ""
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath {
+				v = dep.Version
+			}
+		}
+	}
+	if v == "" {
+		return "unknown"
+	}
+
+	return v
+}
+
+// The git commit that was built, with -dirty if there were uncommitted
+// changes. Empty if unknown.
+func Commit() string {
+	if commit != "" {
+		return commit
+	}
+	c := setting("vcs.revision")
+	if c != "" && setting("vcs.modified") == "true" {
+		c += "-dirty"
+	}
+
+	return c
+}
+
+// When the commit was made or the release was built. Empty if unknown.
+func Date() string {
+	if date != "" {
+		return date
+	}
+	return setting("vcs.time")
+}
+
+// Everything we know about the build on one line
+func String() string {
+	s := "archmirror " + Version()
+	if c := Commit(); c != "" {
+		s += " (" + c
+		if d := Date(); d != "" {
+			s += ", " + d
+		}
+		s += ")"
+	}
+
+	return s + fmt.Sprintf(", %s %s/%s", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,29 @@
+package archmirror
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Finer than slog.LevelDebug, used for every single line read or probe
+const LevelTrace = slog.LevelDebug - 4
+
+// The library stays quiet unless a logger is passed in the context
+var discardLogger = slog.New(slog.DiscardHandler)
+
+type loggerKey struct{}
+
+// Make the functions of the package that are called with the returned
+// context log to l
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// The logger passed with WithLogger, or one that drops everything
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok && l != nil {
+		return l
+	}
+
+	return discardLogger
+}
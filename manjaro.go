@@ -0,0 +1,166 @@
+package archmirror
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Where Manjaro publishes the state of its mirrors
+const ManjaroStatusURL = "https://repo.manjaro.org/status.json"
+
+// The branches of Manjaro in the order of the branches field of its status
+var ManjaroBranches = []string{"stable", "testing", "unstable"}
+
+// How pacman-mirrors names the sections
+const manjaroSectionPrefix = "## Country : "
+
+// A mirror as listed by the Manjaro status API
+type manjaroMirror struct {
+	// The base URL, without the branch
+	URL     string `json:"url"`
+	Country string `json:"country"`
+	// Whether the mirror has synced each branch: 1 if it did, 0 if it is
+	// behind and -1 if it does not carry the branch
+	Branches  []int    `json:"branches"`
+	Protocols []string `json:"protocols"`
+}
+
+// Manjaro, whose status API lists every mirror with the branches it is up to
+// date on. Only the mirrors that synced the branch are used, filtered by
+// country and protocol. The IP versions are ignored.
+type ManjaroFlavor struct {
+	// One of ManjaroBranches, stable if empty
+	Branch string
+}
+
+func (ManjaroFlavor) Name() string {
+	return "manjaro"
+}
+
+// Check that the branch is one of ManjaroBranches
+func ParseManjaroBranch(name string) (string, error) {
+	for _, b := range ManjaroBranches {
+		if name == b {
+			return b, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown branch %q, expected one of %s", name, strings.Join(ManjaroBranches, ", "))
+}
+
+func (f ManjaroFlavor) branch() string {
+	if f.Branch == "" {
+		return "stable"
+	}
+	return f.Branch
+}
+
+// The status API, or c.BaseURL if set
+func (ManjaroFlavor) Source(c *MirrorListConfig) (string, error) {
+	if c.BaseURL == "" {
+		return ManjaroStatusURL, nil
+	}
+	if err := CheckGeneratorURL(c.BaseURL); err != nil {
+		return "", err
+	}
+
+	return c.BaseURL, nil
+}
+
+func (f ManjaroFlavor) RequestMirrorList(ctx context.Context, client *http.Client, c *MirrorListConfig) (*Mirrorlist, error) {
+	url, err := f.Source(c)
+	if err != nil {
+		return nil, err
+	}
+	branch, err := ParseManjaroBranch(f.branch())
+	if err != nil {
+		return nil, err
+	}
+
+	parse := func(r io.Reader) (*Mirrorlist, error) {
+		return ParseManjaroStatus(r, branch)
+	}
+	list, err := requestList(ctx, client, c, url, listFormat{mediaType: "application/json", parse: parse})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.filterList(list); err != nil {
+		return nil, err
+	}
+
+	return finishList(list, c, url)
+}
+
+// The database of extra is large enough to measure the rate
+func (ManjaroFlavor) ProbeTarget() ProbeTarget {
+	return ProbeTarget{Repo: "core", Arch: "x86_64", Small: "core.db", Large: "extra.db"}
+}
+
+func (ManjaroFlavor) Arches() []string {
+	return []string{"x86_64"}
+}
+
+// The branch comes in front of it
+func (ManjaroFlavor) ServerSuffix() string {
+	return "/$repo/$arch"
+}
+
+// Turn the Manjaro mirror status into a mirrorlist of the branch in the
+// format of pacman-mirrors. Mirrors get one Server line for each of their
+// protocols, mirrors that have not synced the branch are left out.
+func ParseManjaroStatus(r io.Reader, branch string) (*Mirrorlist, error) {
+	index := -1
+	for i, b := range ManjaroBranches {
+		if b == branch {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("unknown branch %q", branch)
+	}
+
+	var status []manjaroMirror
+	if err := json.NewDecoder(skipBOM(r)).Decode(&status); err != nil {
+		return nil, fmt.Errorf("decoding the Manjaro mirror status: %w", err)
+	}
+
+	list := &Mirrorlist{
+		Header:        []string{"##", "## Manjaro Linux " + branch + " mirrorlist", "##", ""},
+		SectionPrefix: manjaroSectionPrefix,
+	}
+	for _, s := range status {
+		if index >= len(s.Branches) || s.Branches[index] != 1 {
+			continue
+		}
+		_, rest, ok := strings.Cut(s.URL, "://")
+		if !ok {
+			continue
+		}
+		base := strings.TrimSuffix(rest, "/")
+		for _, name := range s.Protocols {
+			p, err := ParseProtocol(name)
+			if err != nil || p == ProtocolTypeRsync {
+				continue
+			}
+			url := p.String() + "://" + base + "/" + branch + "/$repo/$arch"
+			list.Mirrors = append(list.Mirrors, Mirror{
+				URL:      NormalizeMirrorURL(url),
+				Protocol: p,
+				// The names use underscores, e.g. United_States
+				Country:   strings.ReplaceAll(s.Country, "_", " "),
+				Commented: true,
+			})
+		}
+	}
+	// Render starts a new section whenever the country changes
+	sort.SliceStable(list.Mirrors, func(i, j int) bool {
+		return list.Mirrors[i].Country < list.Mirrors[j].Country
+	})
+
+	return list, nil
+}
@@ -0,0 +1,92 @@
+package archmirror
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseManjaroStatus(t *testing.T) {
+	for _, tc := range []struct {
+		branch string
+		want   []string
+	}{
+		{"stable", []string{
+			"https://manjaro.f.example/stable/$repo/$arch",
+			"https://manjaro.a.example/stable/$repo/$arch",
+			"http://manjaro.a.example/stable/$repo/$arch",
+			"https://manjaro.b.example/manjaro/stable/$repo/$arch",
+		}},
+		{"testing", []string{
+			"https://manjaro.a.example/testing/$repo/$arch",
+			"http://manjaro.a.example/testing/$repo/$arch",
+			"http://manjaro.c.example/testing/$repo/$arch",
+		}},
+		{"unstable", []string{
+			"https://manjaro.a.example/unstable/$repo/$arch",
+			"http://manjaro.a.example/unstable/$repo/$arch",
+			"http://manjaro.c.example/unstable/$repo/$arch",
+		}},
+	} {
+		l, err := ParseManjaroStatus(strings.NewReader(readFixture(t, "manjaro-status.json")), tc.branch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		urls := make([]string, 0, len(l.Mirrors))
+		for _, m := range l.Mirrors {
+			urls = append(urls, m.URL)
+			if m.Active || !m.Commented {
+				t.Errorf("%s is active before the list is finished", m.URL)
+			}
+		}
+		if !slices.Equal(urls, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.branch, urls, tc.want)
+		}
+	}
+}
+
+func TestParseManjaroStatusCountries(t *testing.T) {
+	l, err := ParseManjaroStatus(strings.NewReader(readFixture(t, "manjaro-status.json")), "stable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	countries := make([]string, 0, len(l.Mirrors))
+	for _, m := range l.Mirrors {
+		countries = append(countries, m.Country)
+	}
+	if want := []string{"Brazil", "Germany", "Germany", "United States"}; !slices.Equal(countries, want) {
+		t.Errorf("got %q, want %q", countries, want)
+	}
+	if !strings.Contains(l.Render(), manjaroSectionPrefix+"United States\n") {
+		t.Errorf("the sections are not written like pacman-mirrors does:\n%s", l.Render())
+	}
+}
+
+func TestParseManjaroStatusInvalid(t *testing.T) {
+	if _, err := ParseManjaroStatus(strings.NewReader(readFixture(t, "manjaro-status.json")), "beta"); err == nil {
+		t.Error("an unknown branch was accepted")
+	}
+	if _, err := ParseManjaroStatus(strings.NewReader(`{"mirrors": []}`), "stable"); err == nil {
+		t.Error("a status that is not a list of mirrors was accepted")
+	}
+}
+
+func TestManjaroRequestMirrorList(t *testing.T) {
+	srv := testGenerator(t, http.StatusOK, "application/json", readFixture(t, "manjaro-status.json"))
+	c := &MirrorListConfig{
+		Protocols: []ProtocolType{ProtocolTypeHTTP},
+		Countries: []string{"DE"},
+		BaseURL:   srv.URL + "/status.json",
+	}
+
+	l, err := ManjaroFlavor{Branch: "testing"}.RequestMirrorList(context.Background(), srv.Client(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"http://manjaro.a.example/testing/$repo/$arch", "http://manjaro.c.example/testing/$repo/$arch"}
+	if got := activeURLs(l); !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,61 @@
+package archmirror
+
+const (
+	// The Server lines between these markers survive a Merge
+	KeepMarker    = "# archmirror:keep"
+	KeepEndMarker = "# archmirror:end"
+)
+
+// Put the mirrors of old that have to survive the regeneration at the top of
+// l, inside a keep block. These are the mirrors of the keep block of old or,
+// if old has none, the active mirrors that are not in fetched, the whole list
+// l was made from before it was filtered and cut short. The mirrors of old
+// that were fetched came from us, whether they made it into l or not.
+// Mirrors in both lists are only written once, in the keep block. Merging the
+// result again gives the same list. Returns the number of kept mirrors.
+func (l *Mirrorlist) Merge(old, fetched *Mirrorlist) int {
+	kept := make([]Mirror, 0)
+	for _, m := range old.Mirrors {
+		if m.Kept {
+			kept = append(kept, m)
+		}
+	}
+	if len(kept) == 0 {
+		generated := make(map[string]bool, len(fetched.Mirrors)+len(l.Mirrors))
+		for _, m := range fetched.Mirrors {
+			generated[duplicateKey(m.URL)] = true
+		}
+		for _, m := range l.Mirrors {
+			generated[duplicateKey(m.URL)] = true
+		}
+		for _, m := range old.Mirrors {
+			if m.Active && !generated[duplicateKey(m.URL)] {
+				kept = append(kept, m)
+			}
+		}
+	}
+	if len(kept) == 0 {
+		return 0
+	}
+
+	mirrors := make([]Mirror, 0, len(kept)+len(l.Mirrors))
+	seen := make(map[string]bool, len(kept))
+	for _, m := range kept {
+		if seen[m.URL] {
+			continue
+		}
+		seen[m.URL] = true
+		m.Kept = true
+		m.Country = ""
+		m.Comments = nil
+		mirrors = append(mirrors, m)
+	}
+	for _, m := range l.Mirrors {
+		if !seen[m.URL] {
+			mirrors = append(mirrors, m)
+		}
+	}
+	l.Mirrors = mirrors
+
+	return len(seen)
+}
@@ -0,0 +1,107 @@
+package archmirror
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// A list of active mirrors in a single section
+func testList(country string, urls ...string) *Mirrorlist {
+	l := &Mirrorlist{}
+	for _, url := range urls {
+		l.Mirrors = append(l.Mirrors, Mirror{URL: url, Protocol: protocolFromURL(url), Country: country, Active: true})
+	}
+	return l
+}
+
+func mustParse(t *testing.T, s string) *Mirrorlist {
+	t.Helper()
+	l, err := ParseMirrorlist(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func keptURLs(l *Mirrorlist) []string {
+	urls := make([]string, 0)
+	for _, m := range l.Mirrors {
+		if m.Kept {
+			urls = append(urls, m.URL)
+		}
+	}
+	return urls
+}
+
+// Regenerate the old file like a run with -merge: fetch, cut down to the
+// first n, merge, render and parse again
+func regenerate(t *testing.T, old *Mirrorlist, fetched *Mirrorlist, n int) *Mirrorlist {
+	t.Helper()
+	l := &Mirrorlist{Mirrors: append([]Mirror(nil), fetched.Mirrors...)}
+	l.Truncate(n)
+	l.Merge(old, fetched)
+	l.RemoveDuplicates()
+	return mustParse(t, l.Render())
+}
+
+const localMirror = "https://private.example/$repo/os/$arch"
+
+func TestMergeWithoutKeepBlock(t *testing.T) {
+	fetched := testList("Germany", "https://a.example/$repo/os/$arch", "https://b.example/$repo/os/$arch", "https://c.example/$repo/os/$arch")
+	old := mustParse(t, "Server = "+localMirror+"\n\n## Germany\nServer = https://a.example/$repo/os/$arch\n")
+
+	l := regenerate(t, old, fetched, 3)
+	if want := []string{localMirror}; !slices.Equal(keptURLs(l), want) {
+		t.Errorf("kept %v, want %v", keptURLs(l), want)
+	}
+	want := []string{localMirror, "https://a.example/$repo/os/$arch", "https://b.example/$repo/os/$arch", "https://c.example/$repo/os/$arch"}
+	if !slices.Equal(activeURLs(l), want) {
+		t.Errorf("got %v, want %v", activeURLs(l), want)
+	}
+}
+
+func TestMergeWithKeepBlock(t *testing.T) {
+	fetched := testList("Germany", "https://a.example/$repo/os/$arch", "https://b.example/$repo/os/$arch")
+	// A mirror that is also fetched is written once, inside the keep block
+	old := mustParse(t, KeepMarker+"\nServer = "+localMirror+"\nServer = https://b.example/$repo/os/$arch\n"+KeepEndMarker+"\n\n## Germany\nServer = https://other.example/$repo/os/$arch\n")
+
+	l := regenerate(t, old, fetched, 2)
+	want := []string{localMirror, "https://b.example/$repo/os/$arch"}
+	if !slices.Equal(keptURLs(l), want) {
+		t.Errorf("kept %v, want %v", keptURLs(l), want)
+	}
+	want = append(want, "https://a.example/$repo/os/$arch")
+	if !slices.Equal(activeURLs(l), want) {
+		t.Errorf("got %v, want %v", activeURLs(l), want)
+	}
+}
+
+func TestMergeIsIdempotent(t *testing.T) {
+	fetched := testList("Germany", "https://a.example/$repo/os/$arch", "https://b.example/$repo/os/$arch")
+	for _, old := range []string{
+		"Server = " + localMirror + "\n",
+		KeepMarker + "\nServer = " + localMirror + "\n" + KeepEndMarker + "\n",
+	} {
+		first := regenerate(t, mustParse(t, old), fetched, 2)
+		second := regenerate(t, first, fetched, 2)
+		if first.Render() != second.Render() {
+			t.Errorf("merging twice changed the list:\n%s\nand then\n%s", first.Render(), second.Render())
+		}
+	}
+}
+
+// The mirrors we wrote last time that fell out of the first n must not be
+// taken for ones added by hand
+func TestMergeDoesNotKeepOwnMirrors(t *testing.T) {
+	fetched := testList("Germany", "https://a.example/$repo/os/$arch", "https://b.example/$repo/os/$arch", "https://c.example/$repo/os/$arch")
+	old := mustParse(t, "Server = "+localMirror+"\n\n## Germany\nServer = https://c.example/$repo/os/$arch\nServer = https://b.example/$repo/os/$arch\n")
+
+	l := regenerate(t, old, fetched, 1)
+	if want := []string{localMirror}; !slices.Equal(keptURLs(l), want) {
+		t.Errorf("kept %v, want %v", keptURLs(l), want)
+	}
+	if want := []string{localMirror, "https://a.example/$repo/os/$arch"}; !slices.Equal(activeURLs(l), want) {
+		t.Errorf("got %v, want %v", activeURLs(l), want)
+	}
+}
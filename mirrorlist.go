@@ -0,0 +1,467 @@
+package archmirror
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// The notes of a Mirrorlist are written between these markers and
+	// replaced on every run
+	HeaderMarker    = "# archmirror:header"
+	HeaderEndMarker = "# archmirror:header-end"
+)
+
+// A single Server entry of a mirrorlist
+type Mirror struct {
+	// The URL as written after "Server ="
+	URL      string
+	Protocol ProtocolType
+	// The name of the country section the mirror is listed under
+	Country string
+	// The Server line was commented out in the source
+	Commented bool
+	// The mirror will be written as an active Server line
+	Active bool
+	// Comments and blank lines between the previous entry and this one
+	Comments []string
+	// The measured latency if the mirror was ranked
+	Latency time.Duration
+	// The measured download rate in bytes per second
+	Rate float64
+	// What archlinux.org knows about the mirror, if it was requested
+	Status *MirrorStatus
+	// When the mirror last synced according to its lastsync file, zero if
+	// it was not checked
+	LastSync time.Time
+	// How far the mirror is behind the master mirror, nil if unknown
+	Lag *time.Duration
+	// The mirror is part of the block that Merge keeps
+	Kept bool
+}
+
+// A parsed pacman mirrorlist
+type Mirrorlist struct {
+	// The comment block at the top of the list
+	Header  []string
+	Mirrors []Mirror
+	// Everything after the last mirror
+	Footer []string
+	// When the list was fetched from the generator
+	Generated time.Time
+	// The list was taken from the cache, either because it was recent
+	// enough or because the generator said it did not change
+	FromCache bool
+	// How the list was generated, written as a comment block in front of
+	// the header
+	Notes []string
+	// Written in front of the name of each section, "## " if empty
+	SectionPrefix string
+	// The inactive mirrors after the active ones are written under
+	// FallbackSection instead of their country
+	Fallback bool
+}
+
+// Parse the protocol of a mirror URL
+func protocolFromURL(url string) ProtocolType {
+	switch {
+	case strings.HasPrefix(url, "https://"):
+		return ProtocolTypeHTTPS
+	case strings.HasPrefix(url, "http://"):
+		return ProtocolTypeHTTP
+	case strings.HasPrefix(url, "rsync://"):
+		return ProtocolTypeRsync
+	}
+
+	return ProtocolTypeUnknown
+}
+
+// Parse a "Server = URL" or "#Server = URL" line. ok is false if the line is
+// something else.
+func parseServerLine(line string) (url string, commented bool, ok bool) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "#") {
+		commented = true
+		line = strings.TrimSpace(strings.TrimLeft(line, "#"))
+	}
+
+	if !strings.HasPrefix(line, "Server") {
+		return "", false, false
+	}
+	line = strings.TrimSpace(strings.TrimPrefix(line, "Server"))
+	if !strings.HasPrefix(line, "=") {
+		return "", false, false
+	}
+
+	url = strings.TrimSpace(strings.TrimPrefix(line, "="))
+	return url, commented, url != ""
+}
+
+// Parse a "## Country" section header. pacman-mirrors writes them as
+// "## Country : Name".
+func parseSectionLine(line string) (string, bool) {
+	if !strings.HasPrefix(line, "## ") {
+		return "", false
+	}
+
+	name := strings.TrimSpace(strings.TrimPrefix(line, "## "))
+	if rest, ok := strings.CutPrefix(name, "Country :"); ok {
+		name = strings.TrimSpace(rest)
+	}
+	return name, name != ""
+}
+
+// Parse a mirrorlist as produced by the generator
+func ParseMirrorlist(r io.Reader) (*Mirrorlist, error) {
+	list := &Mirrorlist{}
+	country := ""
+	keeping := false
+	inHeader := false
+	pending := make([]string, 0)
+	reader := bufio.NewReader(skipBOM(r))
+	for {
+		str, err := reader.ReadString('\n')
+
+		if str != "" || err == nil {
+			line := cleanLine(strings.TrimSuffix(str, "\n"))
+			marker := strings.TrimSpace(line)
+			if marker == HeaderMarker || marker == HeaderEndMarker {
+				// Our own header is written anew every time
+				inHeader = marker == HeaderMarker
+			} else if inHeader {
+				continue
+			} else if marker == KeepMarker || marker == KeepEndMarker {
+				// Render writes the markers around the kept mirrors
+				keeping = marker == KeepMarker
+			} else if url, commented, ok := parseServerLine(line); ok {
+				url = NormalizeMirrorURL(url)
+				list.addMirror(Mirror{
+					URL:       url,
+					Protocol:  protocolFromURL(url),
+					Commented: commented,
+					Active:    !commented,
+					Kept:      keeping,
+				}, &country, pending)
+				pending = make([]string, 0)
+			} else {
+				pending = append(pending, line)
+			}
+		}
+
+		// We will read the response stream until the EOF is reached. Any
+		// other error would leave us with a truncated list.
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading mirrorlist body: %w", err)
+		}
+	}
+
+	if len(list.Mirrors) == 0 {
+		list.Header = pending
+	} else {
+		list.Footer = pending
+	}
+
+	return list, nil
+}
+
+// Check that pacman has at least min mirrors to choose from before the list
+// is written. Returns a *TooFewMirrorsError if not.
+func (l *Mirrorlist) RequireMirrors(min int) error {
+	active := 0
+	for _, m := range l.Mirrors {
+		if m.Active {
+			active++
+		}
+	}
+	if active < min {
+		return &TooFewMirrorsError{Active: active, Min: min}
+	}
+
+	return nil
+}
+
+// Read a mirrorlist from a file
+func ReadMirrorlistFile(path string) (*Mirrorlist, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseMirrorlist(file)
+}
+
+// Parse either a mirrorlist or a bare list of mirror URLs, one per line. URLs
+// without $repo are taken to be the base of an Arch Linux mirror. Blank lines
+// and # comments are ignored in a bare list.
+func ParseMirrorlistOrURLs(r io.Reader) (*Mirrorlist, error) {
+	data, err := io.ReadAll(skipBOM(r))
+	if err != nil {
+		return nil, fmt.Errorf("reading mirrorlist body: %w", err)
+	}
+
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines {
+		if _, _, ok := parseServerLine(line); ok {
+			return ParseMirrorlist(strings.NewReader(string(data)))
+		}
+	}
+
+	list := &Mirrorlist{}
+	for n, line := range lines {
+		url := strings.TrimSpace(line)
+		if url == "" || strings.HasPrefix(url, "#") {
+			continue
+		}
+		if !strings.Contains(url, "://") {
+			return nil, fmt.Errorf("line %d: %q is neither a Server line nor a URL", n+1, url)
+		}
+		if !strings.Contains(url, "$repo") {
+			url = strings.TrimSuffix(url, "/") + "/$repo/os/$arch"
+		}
+		url = NormalizeMirrorURL(url)
+		list.Mirrors = append(list.Mirrors, Mirror{
+			URL:      url,
+			Protocol: protocolFromURL(url),
+			Active:   true,
+		})
+	}
+
+	return list, nil
+}
+
+// Append a mirror, sorting the lines in front of it into the header, a
+// section header or the mirror's own comments
+func (l *Mirrorlist) addMirror(m Mirror, country *string, pending []string) {
+	// A "## Country" line right in front of the mirror starts a new section
+	if n := len(pending); n > 0 {
+		if name, ok := parseSectionLine(pending[n-1]); ok {
+			*country = name
+			pending = pending[:n-1]
+			// The blank line separating sections is written by Render
+			if len(l.Mirrors) > 0 && len(pending) > 0 && strings.TrimSpace(pending[len(pending)-1]) == "" {
+				pending = pending[:len(pending)-1]
+			}
+		}
+	}
+
+	if len(l.Mirrors) == 0 {
+		l.Header = pending
+	} else {
+		m.Comments = pending
+	}
+	m.Country = *country
+	l.Mirrors = append(l.Mirrors, m)
+}
+
+// The Server line of the mirror
+func (m *Mirror) Line() string {
+	url := NormalizeMirrorURL(m.URL)
+	if m.Active {
+		return "Server = " + url
+	}
+
+	return "#Server = " + url
+}
+
+// Write the mirrorlist in the pacman format
+func (l *Mirrorlist) Render() string {
+	var b strings.Builder
+	if len(l.Notes) > 0 {
+		b.WriteString(HeaderMarker + "\n")
+		for _, note := range l.Notes {
+			b.WriteString("## " + note + "\n")
+		}
+		b.WriteString(HeaderEndMarker + "\n")
+	}
+	for _, line := range l.Header {
+		b.WriteString(line + "\n")
+	}
+
+	fallback := l.fallbackStart()
+	section := func(i int) string {
+		if i >= fallback {
+			return FallbackSection
+		}
+		return l.Mirrors[i].Country
+	}
+	for i, m := range l.Mirrors {
+		if i == 0 || section(i) != section(i-1) {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			if name := section(i); name != "" {
+				b.WriteString(l.sectionPrefix() + name + "\n")
+			}
+		}
+		if m.Kept && (i == 0 || !l.Mirrors[i-1].Kept) {
+			b.WriteString(KeepMarker + "\n")
+		}
+		for _, line := range m.Comments {
+			b.WriteString(line + "\n")
+		}
+		b.WriteString(m.Line() + "\n")
+		if m.Kept && (i == len(l.Mirrors)-1 || !l.Mirrors[i+1].Kept) {
+			b.WriteString(KeepEndMarker + "\n")
+		}
+	}
+
+	for _, line := range l.Footer {
+		b.WriteString(line + "\n")
+	}
+
+	return b.String()
+}
+
+// The index of the first mirror of the fallback section, the first inactive
+// mirror after the active ones
+func (l *Mirrorlist) fallbackStart() int {
+	if l.Fallback {
+		for i := 1; i < len(l.Mirrors); i++ {
+			if !l.Mirrors[i].Active && l.Mirrors[i-1].Active {
+				return i
+			}
+		}
+	}
+	return len(l.Mirrors)
+}
+
+func (l *Mirrorlist) sectionPrefix() string {
+	if l.SectionPrefix == "" {
+		return "## "
+	}
+	return l.SectionPrefix
+}
+
+// Add a line describing how the list was generated to our header
+func (l *Mirrorlist) AddHeaderNote(note string) {
+	l.Notes = append(l.Notes, note)
+}
+
+// Activate all mirrors
+func (l *Mirrorlist) Activate() {
+	for i := range l.Mirrors {
+		l.Mirrors[i].Active = true
+	}
+}
+
+// The section that Render writes the mirrors after those of ActivateTop
+// under
+const FallbackSection = "Fallback mirrors"
+
+// Only activate the first n mirrors. The others are commented out and
+// written to a section of fallback mirrors, their country is kept for the
+// other output formats.
+func (l *Mirrorlist) ActivateTop(n int) {
+	for i := range l.Mirrors {
+		l.Mirrors[i].Active = i < n
+	}
+	l.Fallback = n < len(l.Mirrors)
+}
+
+// The part of a mirror URL that tells mirrors apart: the normalized URL
+// without doubled or trailing slashes
+func duplicateKey(url string) string {
+	scheme, rest, ok := strings.Cut(NormalizeMirrorURL(url), "://")
+	if !ok {
+		return url
+	}
+	for strings.Contains(rest, "//") {
+		rest = strings.ReplaceAll(rest, "//", "/")
+	}
+
+	return scheme + "://" + strings.TrimSuffix(rest, "/")
+}
+
+// Remove mirrors that have already been listed, keeping the better ranked
+// first one. Comments in front of a removed mirror go to the next one of the
+// same section. Returns the number of removed mirrors.
+func (l *Mirrorlist) RemoveDuplicates() int {
+	seen := make(map[string]bool)
+	mirrors := make([]Mirror, 0, len(l.Mirrors))
+	var orphaned []string
+	for i, m := range l.Mirrors {
+		key := duplicateKey(m.URL)
+		if seen[key] {
+			if i+1 < len(l.Mirrors) && l.Mirrors[i+1].Country == m.Country {
+				orphaned = append(orphaned, m.Comments...)
+			} else {
+				orphaned = nil
+			}
+			continue
+		}
+		seen[key] = true
+		if len(orphaned) > 0 {
+			m.Comments = append(orphaned, m.Comments...)
+			orphaned = nil
+		}
+		mirrors = append(mirrors, m)
+	}
+	removed := len(l.Mirrors) - len(mirrors)
+	l.Mirrors = mirrors
+
+	return removed
+}
+
+// Only keep the first n mirrors
+func (l *Mirrorlist) Truncate(n int) {
+	if n < len(l.Mirrors) {
+		l.Mirrors = l.Mirrors[:n]
+	}
+}
+
+// Only keep the mirrors at the given indices, in that order
+func (l *Mirrorlist) Select(indices []int) {
+	mirrors := make([]Mirror, 0, len(indices))
+	for _, i := range indices {
+		mirrors = append(mirrors, l.Mirrors[i])
+	}
+	l.Mirrors = mirrors
+}
+
+// The section GroupByCountry puts the mirrors without a country in
+const OtherSection = "Other"
+
+// Move the mirrors of each country together, keeping their order otherwise.
+// The countries are in the order they first appear in, mirrors without one
+// go to OtherSection.
+func (l *Mirrorlist) GroupByCountry() {
+	groups := make(map[string][]Mirror)
+	order := make([]string, 0)
+	for _, m := range l.Mirrors {
+		if m.Country == "" {
+			m.Country = OtherSection
+		}
+		if _, ok := groups[m.Country]; !ok {
+			order = append(order, m.Country)
+		}
+		groups[m.Country] = append(groups[m.Country], m)
+	}
+
+	mirrors := make([]Mirror, 0, len(l.Mirrors))
+	for _, country := range order {
+		mirrors = append(mirrors, groups[country]...)
+	}
+	l.Mirrors = mirrors
+}
+
+// Randomize the order of the mirrors within each country section
+func (l *Mirrorlist) Shuffle() {
+	start := 0
+	for i := 1; i <= len(l.Mirrors); i++ {
+		if i == len(l.Mirrors) || l.Mirrors[i].Country != l.Mirrors[start].Country {
+			section := l.Mirrors[start:i]
+			rand.Shuffle(len(section), func(a, b int) {
+				section[a], section[b] = section[b], section[a]
+			})
+			start = i
+		}
+	}
+}
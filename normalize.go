@@ -0,0 +1,56 @@
+package archmirror
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Some editors and proxies put one in front of a UTF-8 text
+const byteOrderMark = "\ufeff"
+
+// Skip a byte order mark at the start of r
+func skipBOM(r io.Reader) io.Reader {
+	b := bufio.NewReader(r)
+	if start, _ := b.Peek(len(byteOrderMark)); string(start) == byteOrderMark {
+		b.Discard(len(byteOrderMark))
+	}
+	return b
+}
+
+// Remove the carriage return of CRLF line endings and trailing whitespace
+// from a line
+func cleanLine(line string) string {
+	return strings.TrimRight(line, " \t\r")
+}
+
+// The ports that go without saying for each scheme
+var defaultPorts = map[string]string{
+	"http":  ":80",
+	"https": ":443",
+	"rsync": ":873",
+}
+
+// Bring a mirror URL into the form we write: lowercase scheme and host,
+// without the default port and with exactly one slash in front of $repo. The
+// pacman variables are left as they are.
+func NormalizeMirrorURL(url string) string {
+	url = strings.TrimSpace(url)
+	scheme, rest, ok := strings.Cut(url, "://")
+	if !ok {
+		return url
+	}
+	scheme = strings.ToLower(scheme)
+	host, path, _ := strings.Cut(rest, "/")
+	host = strings.TrimSuffix(strings.ToLower(host), defaultPorts[scheme])
+
+	if i := strings.Index(path, "$repo"); i >= 0 {
+		prefix := strings.TrimRight(path[:i], "/")
+		if prefix != "" {
+			prefix += "/"
+		}
+		path = prefix + path[i:]
+	}
+
+	return scheme + "://" + host + "/" + path
+}
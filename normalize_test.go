@@ -0,0 +1,149 @@
+package archmirror
+
+import (
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeMirrorURL(t *testing.T) {
+	for _, tc := range []struct {
+		url, want string
+	}{
+		{"https://a.example/$repo/os/$arch", "https://a.example/$repo/os/$arch"},
+		{"HTTPS://A.Example/$repo/os/$arch", "https://a.example/$repo/os/$arch"},
+		{"https://a.example:443/archlinux/$repo/os/$arch", "https://a.example/archlinux/$repo/os/$arch"},
+		{"http://a.example:80/$repo/os/$arch", "http://a.example/$repo/os/$arch"},
+		{"rsync://a.example:873/archlinux/$repo/os/$arch", "rsync://a.example/archlinux/$repo/os/$arch"},
+		// Only the default port of the scheme goes
+		{"http://a.example:443/$repo/os/$arch", "http://a.example:443/$repo/os/$arch"},
+		{"https://a.example:8443/$repo/os/$arch", "https://a.example:8443/$repo/os/$arch"},
+		{"https://a.example/archlinux//$repo/os/$arch", "https://a.example/archlinux/$repo/os/$arch"},
+		{"https://a.example//$repo/os/$arch", "https://a.example/$repo/os/$arch"},
+		// The path is case sensitive, and so are the variables
+		{"https://a.example/ArchLinux/$repo/os/$arch", "https://a.example/ArchLinux/$repo/os/$arch"},
+		{"  https://a.example/$repo/$arch  ", "https://a.example/$repo/$arch"},
+		{"https://a.example/archlinux/", "https://a.example/archlinux/"},
+		{"https://a.example", "https://a.example/"},
+		{"not a url", "not a url"},
+	} {
+		if got := NormalizeMirrorURL(tc.url); got != tc.want {
+			t.Errorf("NormalizeMirrorURL(%q) = %q, want %q", tc.url, got, tc.want)
+		}
+	}
+}
+
+func TestParseMirrorlistNormalizes(t *testing.T) {
+	for _, tc := range []struct {
+		line     string
+		url      string
+		protocol ProtocolType
+	}{
+		{"Server = HTTPS://A.Example:443/archlinux//$repo/os/$arch", "https://a.example/archlinux/$repo/os/$arch", ProtocolTypeHTTPS},
+		{"#Server = Http://a.example/$repo/os/$arch", "http://a.example/$repo/os/$arch", ProtocolTypeHTTP},
+		{"Server = RSYNC://a.example/$repo/os/$arch", "rsync://a.example/$repo/os/$arch", ProtocolTypeRsync},
+		{"Server = ftp://a.example/$repo/os/$arch", "ftp://a.example/$repo/os/$arch", ProtocolTypeUnknown},
+	} {
+		l := mustParse(t, tc.line+"\n")
+		if len(l.Mirrors) != 1 {
+			t.Fatalf("got %d mirrors from %q", len(l.Mirrors), tc.line)
+		}
+		if m := l.Mirrors[0]; m.URL != tc.url || m.Protocol != tc.protocol {
+			t.Errorf("%q: got %s (%s), want %s (%s)", tc.line, m.URL, m.Protocol, tc.url, tc.protocol)
+		}
+	}
+}
+
+func TestParseMirrorlistOrURLsNormalizes(t *testing.T) {
+	l, err := ParseMirrorlistOrURLs(strings.NewReader("# mirrors\nHTTPS://A.Example:443/archlinux/\nhttp://b.example/$repo/os/$arch\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Mirror{
+		{URL: "https://a.example/archlinux/$repo/os/$arch", Protocol: ProtocolTypeHTTPS},
+		{URL: "http://b.example/$repo/os/$arch", Protocol: ProtocolTypeHTTP},
+	}
+	if len(l.Mirrors) != len(want) {
+		t.Fatalf("got %d mirrors, want %d", len(l.Mirrors), len(want))
+	}
+	for i, m := range l.Mirrors {
+		if m.URL != want[i].URL || m.Protocol != want[i].Protocol {
+			t.Errorf("got %s (%s), want %s (%s)", m.URL, m.Protocol, want[i].URL, want[i].Protocol)
+		}
+	}
+}
+
+func TestParseMirrorlistCRLF(t *testing.T) {
+	l := mustParse(t, readFixture(t, "crlf.mirrorlist"))
+	want := []Mirror{
+		{URL: "https://a.example/$repo/os/$arch", Country: "Germany", Active: true},
+		{URL: "https://b.example/archlinux/$repo/os/$arch", Country: "Germany", Commented: true},
+		{URL: "http://c.example/$repo/os/$arch", Country: "France", Active: true},
+	}
+	if len(l.Mirrors) != len(want) {
+		t.Fatalf("got %d mirrors, want %d", len(l.Mirrors), len(want))
+	}
+	for i, m := range l.Mirrors {
+		if m.URL != want[i].URL || m.Country != want[i].Country || m.Active != want[i].Active || m.Commented != want[i].Commented {
+			t.Errorf("got %+v, want %+v", m, want[i])
+		}
+	}
+	for _, line := range l.Header {
+		if strings.ContainsAny(line, "\r\ufeff") {
+			t.Errorf("the header line %q was not cleaned", line)
+		}
+	}
+
+	out := l.Render()
+	if strings.ContainsAny(out, "\r\ufeff") {
+		t.Errorf("the list is written with CRLF or a BOM:\n%q", out)
+	}
+	if again := mustParse(t, out).Render(); again != out {
+		t.Errorf("parsing the written list again changed it:\n%s\nand then\n%s", out, again)
+	}
+}
+
+func TestParseMirrorlistOrURLsCRLF(t *testing.T) {
+	l, err := ParseMirrorlistOrURLs(strings.NewReader(readFixture(t, "crlf.urls")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://a.example/archlinux/$repo/os/$arch", "http://b.example/$repo/os/$arch"}
+	if got := activeURLs(l); !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRequestMirrorListCRLF(t *testing.T) {
+	srv := testGenerator(t, http.StatusOK, "text/plain", readFixture(t, "crlf.mirrorlist"))
+
+	list, err := RequestMirrorListWithClient(srv.Client(), testConfig(srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://a.example/$repo/os/$arch", "https://b.example/archlinux/$repo/os/$arch", "http://c.example/$repo/os/$arch"}
+	if got := activeURLs(list); !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSkipBOM(t *testing.T) {
+	for in, want := range map[string]string{
+		"\ufeffServer = x": "Server = x",
+		"Server = x":       "Server = x",
+		"\ufeff":           "",
+		"":                 "",
+		// Only at the very start
+		"a\ufeff": "a\ufeff",
+	} {
+		got, err := io.ReadAll(skipBOM(strings.NewReader(in)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("skipBOM(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package archmirror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Writes the mirrorlist that was generated using the configuration in a
+// specific format
+type OutputFormat func(w io.Writer, l *Mirrorlist, c *MirrorListConfig) error
+
+// The supported output formats
+var OutputFormats = map[string]OutputFormat{
+	"pacman": WritePacman,
+	"json":   WriteJSON,
+	"plain":  WritePlain,
+	"yaml":   WriteYAML,
+}
+
+// The names of all output formats
+func OutputFormatNames() []string {
+	names := make([]string, 0, len(OutputFormats))
+	for name := range OutputFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Look up an output format by its name
+func GetOutputFormat(name string) (OutputFormat, error) {
+	format, ok := OutputFormats[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown output format %q, expected one of %s", name, strings.Join(OutputFormatNames(), ", "))
+	}
+
+	return format, nil
+}
+
+// Write the mirrorlist in the format pacman uses
+func WritePacman(w io.Writer, l *Mirrorlist, c *MirrorListConfig) error {
+	for _, m := range l.Mirrors {
+		if m.Protocol == ProtocolTypeRsync {
+			return errors.New("pacman cannot use rsync mirrors, choose a different output format")
+		}
+	}
+
+	_, err := io.WriteString(w, l.Render())
+	return err
+}
+
+type jsonParameters struct {
+	Protocols  []string `json:"protocols"`
+	IPVersions []string `json:"ip_versions"`
+	Countries  []string `json:"countries"`
+}
+
+type jsonMirror struct {
+	URL       string  `json:"url"`
+	Protocol  string  `json:"protocol"`
+	Country   string  `json:"country"`
+	Commented bool    `json:"commented"`
+	LatencyMS int64   `json:"latency_ms,omitempty"`
+	Rate      float64 `json:"rate_bytes_per_second,omitempty"`
+	// From the lastsync file of the mirror
+	LastSync *time.Time `json:"last_sync,omitempty"`
+	// Behind the master mirror
+	LagSeconds *int64 `json:"lag_seconds,omitempty"`
+	// From the mirror status, lower is better
+	Score *float64 `json:"score,omitempty"`
+}
+
+type jsonDocument struct {
+	Generated  time.Time      `json:"generated"`
+	Parameters jsonParameters `json:"parameters"`
+	Mirrors    []jsonMirror   `json:"mirrors"`
+}
+
+// Write one mirror URL per line
+func WritePlain(w io.Writer, l *Mirrorlist, c *MirrorListConfig) error {
+	var b strings.Builder
+	for _, m := range l.Mirrors {
+		b.WriteString(m.URL + "\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Write the mirrors and the parameters used to request them as JSON
+func WriteJSON(w io.Writer, l *Mirrorlist, c *MirrorListConfig) error {
+	out := jsonDocument{
+		Generated: l.Generated.UTC(),
+		Parameters: jsonParameters{
+			Protocols:  make([]string, 0, len(c.Protocols)),
+			IPVersions: make([]string, 0, len(c.IPVersions)),
+			Countries:  append([]string{}, c.Countries...),
+		},
+		Mirrors: make([]jsonMirror, 0, len(l.Mirrors)),
+	}
+	for _, p := range c.Protocols {
+		out.Parameters.Protocols = append(out.Parameters.Protocols, p.String())
+	}
+	for _, v := range c.IPVersions {
+		out.Parameters.IPVersions = append(out.Parameters.IPVersions, v.String())
+	}
+	for _, m := range l.Mirrors {
+		mirror := jsonMirror{
+			URL:       m.URL,
+			Protocol:  m.Protocol.String(),
+			Country:   m.Country,
+			Commented: m.Commented,
+			LatencyMS: m.Latency.Milliseconds(),
+			Rate:      m.Rate,
+		}
+		if !m.LastSync.IsZero() {
+			synced := m.LastSync.UTC()
+			mirror.LastSync = &synced
+		}
+		if m.Lag != nil {
+			seconds := int64(m.Lag.Seconds())
+			mirror.LagSeconds = &seconds
+		}
+		if m.Status != nil && m.Status.Score != nil {
+			mirror.Score = m.Status.Score
+		}
+		out.Mirrors = append(out.Mirrors, mirror)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// Quote a string for YAML. The escapes of strconv.Quote are valid in double
+// quoted YAML strings, but for invalid UTF-8 it writes \xff, which YAML
+// reads as U+00FF.
+func yamlQuote(s string) string {
+	return strconv.Quote(strings.ToValidUTF8(s, "\uFFFD"))
+}
+
+// Quote a list of strings as a YAML flow sequence
+func yamlList(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, yamlQuote(v))
+	}
+
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// Write the mirrors and the parameters used to request them as YAML
+func WriteYAML(w io.Writer, l *Mirrorlist, c *MirrorListConfig) error {
+	protocols := make([]string, 0, len(c.Protocols))
+	for _, p := range c.Protocols {
+		protocols = append(protocols, p.String())
+	}
+	ipVersions := make([]string, 0, len(c.IPVersions))
+	for _, v := range c.IPVersions {
+		ipVersions = append(ipVersions, v.String())
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "generated: %s\n", yamlQuote(l.Generated.UTC().Format(time.RFC3339)))
+	b.WriteString("parameters:\n")
+	fmt.Fprintf(&b, "  protocols: %s\n", yamlList(protocols))
+	fmt.Fprintf(&b, "  ip_versions: %s\n", yamlList(ipVersions))
+	fmt.Fprintf(&b, "  countries: %s\n", yamlList(c.Countries))
+
+	if len(l.Mirrors) == 0 {
+		b.WriteString("mirrors: []\n")
+	} else {
+		b.WriteString("mirrors:\n")
+	}
+	for _, m := range l.Mirrors {
+		fmt.Fprintf(&b, "  - url: %s\n", yamlQuote(m.URL))
+		fmt.Fprintf(&b, "    protocol: %s\n", yamlQuote(m.Protocol.String()))
+		fmt.Fprintf(&b, "    country: %s\n", yamlQuote(m.Country))
+		fmt.Fprintf(&b, "    commented: %t\n", m.Commented)
+		if m.Latency > 0 {
+			fmt.Fprintf(&b, "    latency_ms: %d\n", m.Latency.Milliseconds())
+		}
+		if m.Rate > 0 {
+			fmt.Fprintf(&b, "    rate_bytes_per_second: %.0f\n", m.Rate)
+		}
+		if !m.LastSync.IsZero() {
+			fmt.Fprintf(&b, "    last_sync: %s\n", yamlQuote(m.LastSync.UTC().Format(time.RFC3339)))
+		}
+		if m.Lag != nil {
+			fmt.Fprintf(&b, "    lag_seconds: %d\n", int64(m.Lag.Seconds()))
+		}
+		if m.Status != nil && m.Status.Score != nil {
+			fmt.Fprintf(&b, "    score: %s\n", strconv.FormatFloat(*m.Status.Score, 'f', -1, 64))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
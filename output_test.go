@@ -0,0 +1,269 @@
+package archmirror
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// Decode a double quoted YAML scalar with the escapes of the YAML spec, which
+// are not quite those of Go
+func yamlUnquote(t *testing.T, s string) string {
+	t.Helper()
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		t.Fatalf("%s is not a double quoted YAML string", s)
+	}
+	s = s[1 : len(s)-1]
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' {
+			t.Fatalf("unescaped quote in %s", s)
+		}
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			t.Fatalf("%s ends in a backslash", s)
+		}
+		hex := 0
+		switch s[i] {
+		case '0':
+			b.WriteByte(0)
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 't', '\t':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'v':
+			b.WriteByte('\v')
+		case 'f':
+			b.WriteByte('\f')
+		case 'r':
+			b.WriteByte('\r')
+		case 'e':
+			b.WriteByte(0x1b)
+		case ' ', '"', '/', '\\':
+			b.WriteByte(s[i])
+		case 'N':
+			b.WriteRune('\u0085')
+		case '_':
+			b.WriteRune('\u00a0')
+		case 'L':
+			b.WriteRune('\u2028')
+		case 'P':
+			b.WriteRune('\u2029')
+		case 'x':
+			hex = 2
+		case 'u':
+			hex = 4
+		case 'U':
+			hex = 8
+		default:
+			t.Fatalf(`\%c is not a YAML escape`, s[i])
+		}
+		if hex > 0 {
+			if i+hex >= len(s) {
+				t.Fatalf("short escape in %s", s)
+			}
+			r, err := strconv.ParseUint(s[i+1:i+1+hex], 16, 32)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// A code point, even for \x
+			b.WriteRune(rune(r))
+			i += hex
+		}
+	}
+
+	return b.String()
+}
+
+// The mirrors of a document written by WriteYAML, as the key/value pairs of
+// each item
+func readYAMLMirrors(t *testing.T, doc string) []map[string]string {
+	t.Helper()
+	mirrors := make([]map[string]string, 0)
+	s := bufio.NewScanner(strings.NewReader(doc))
+	inMirrors := false
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case line == "mirrors: []":
+			return mirrors
+		case line == "mirrors:":
+			inMirrors = true
+			continue
+		case !inMirrors:
+			continue
+		case strings.HasPrefix(line, "  - "):
+			mirrors = append(mirrors, map[string]string{})
+			line = line[4:]
+		case strings.HasPrefix(line, "    ") && len(mirrors) > 0:
+			line = line[4:]
+		default:
+			t.Fatalf("unexpected line %q", line)
+		}
+
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			t.Fatalf("%q is not a key and a value", line)
+		}
+		if strings.HasPrefix(value, `"`) {
+			value = yamlUnquote(t, value)
+		}
+		mirrors[len(mirrors)-1][key] = value
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return mirrors
+}
+
+func writeFormat(t *testing.T, format OutputFormat, l *Mirrorlist) string {
+	t.Helper()
+	var buf bytes.Buffer
+	c := &MirrorListConfig{Protocols: []ProtocolType{ProtocolTypeHTTPS}, IPVersions: []IPVersion{IPVersion4}, Countries: []string{"DE"}}
+	if err := format(&buf, l, c); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestWriteYAMLHasThePlainMirrors(t *testing.T) {
+	l := mustParse(t, testMirrorlist)
+	l.Mirrors = append(l.Mirrors, testList("France", "http://c.example/archlinux/$repo/os/$arch").Mirrors...)
+	l.Mirrors[0].Latency = 42 * time.Millisecond
+	l.Mirrors[1].Rate = 1e6
+	l.Generated = time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+
+	plain := strings.Fields(writeFormat(t, WritePlain, l))
+	mirrors := readYAMLMirrors(t, writeFormat(t, WriteYAML, l))
+	if len(mirrors) != len(plain) {
+		t.Fatalf("the YAML has %d mirrors, the plain format %d", len(mirrors), len(plain))
+	}
+	for i, m := range mirrors {
+		if m["url"] != plain[i] {
+			t.Errorf("mirror %d is %q, want %q", i, m["url"], plain[i])
+		}
+		if want := l.Mirrors[i].Protocol.String(); m["protocol"] != want {
+			t.Errorf("mirror %d has protocol %q, want %q", i, m["protocol"], want)
+		}
+		if m["country"] != l.Mirrors[i].Country {
+			t.Errorf("mirror %d is in %q, want %q", i, m["country"], l.Mirrors[i].Country)
+		}
+	}
+	if mirrors[0]["latency_ms"] != "42" {
+		t.Errorf("got latency %q, want 42", mirrors[0]["latency_ms"])
+	}
+	if mirrors[1]["rate_bytes_per_second"] != "1000000" {
+		t.Errorf("got rate %q, want 1000000", mirrors[1]["rate_bytes_per_second"])
+	}
+}
+
+func TestWriteYAMLEmpty(t *testing.T) {
+	doc := writeFormat(t, WriteYAML, &Mirrorlist{})
+	if !strings.Contains(doc, "\nmirrors: []\n") {
+		t.Errorf("an empty list is written as\n%s", doc)
+	}
+}
+
+func TestYAMLQuote(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"Germany",
+		`say "hi"`,
+		`C:\mirror`,
+		"# not a comment",
+		"key: value",
+		"- item",
+		"tab\tand\nnewline",
+		"\x00\x01\x1b\x7f",
+		"Réunion",
+		"Türkiye 🇹🇷",
+		"line\u2028separator\u0085next",
+		"bom\ufeff",
+		"\U0010ffff",
+	} {
+		if got := yamlUnquote(t, yamlQuote(s)); got != s {
+			t.Errorf("%q came back as %q from %s", s, got, yamlQuote(s))
+		}
+	}
+}
+
+func TestYAMLQuoteInvalidUTF8(t *testing.T) {
+	got := yamlUnquote(t, yamlQuote("caf\xe9"))
+	if !utf8.ValidString(got) || got != "caf\ufffd" {
+		t.Errorf("got %q, want %q", got, "caf\ufffd")
+	}
+}
+
+func TestActivateTopKeepsTheCountries(t *testing.T) {
+	l := mustParse(t, testMirrorlist)
+	l.Mirrors = append(l.Mirrors, testList("France", "https://c.example/archlinux/$repo/os/$arch").Mirrors...)
+	l.ActivateTop(1)
+
+	var doc struct {
+		Mirrors []struct {
+			URL     string `json:"url"`
+			Country string `json:"country"`
+		} `json:"mirrors"`
+	}
+	if err := json.Unmarshal([]byte(writeFormat(t, WriteJSON, l)), &doc); err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range doc.Mirrors {
+		if want := l.Mirrors[i].Country; m.Country != want || want == FallbackSection {
+			t.Errorf("%s is in %q, want %q", m.URL, m.Country, want)
+		}
+	}
+
+	want := "## Germany\n" +
+		"Server = https://a.example/$repo/os/$arch\n" +
+		"\n## " + FallbackSection + "\n" +
+		"#Server = https://b.example/archlinux/$repo/os/$arch\n" +
+		"#Server = https://c.example/archlinux/$repo/os/$arch\n"
+	if got := l.Render(); !strings.HasSuffix(got, want) {
+		t.Errorf("got\n%s\nwant it to end in\n%s", got, want)
+	}
+}
+
+func TestWriteScore(t *testing.T) {
+	l := mustParse(t, testMirrorlist)
+	score := 1.25
+	l.Mirrors[0].Status = &MirrorStatus{Score: &score}
+	// Known to the status, but without a score
+	l.Mirrors[1].Status = &MirrorStatus{}
+
+	var doc struct {
+		Mirrors []map[string]any `json:"mirrors"`
+	}
+	if err := json.Unmarshal([]byte(writeFormat(t, WriteJSON, l)), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if got := doc.Mirrors[0]["score"]; got != score {
+		t.Errorf("the JSON has score %v, want %v", got, score)
+	}
+	if got, ok := doc.Mirrors[1]["score"]; ok {
+		t.Errorf("the JSON has score %v for a mirror without one", got)
+	}
+
+	mirrors := readYAMLMirrors(t, writeFormat(t, WriteYAML, l))
+	if mirrors[0]["score"] != "1.25" {
+		t.Errorf("the YAML has score %q, want 1.25", mirrors[0]["score"])
+	}
+	if got, ok := mirrors[1]["score"]; ok {
+		t.Errorf("the YAML has score %q for a mirror without one", got)
+	}
+}
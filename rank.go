@@ -0,0 +1,668 @@
+package archmirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How the mirrors are ranked
+type RankMode string
+
+const (
+	// Keep the order of the generator
+	RankNone RankMode = ""
+	// Sort by the time it takes to fetch a small file
+	RankLatency RankMode = "latency"
+	// Sort by the download rate of a repository database
+	RankRate RankMode = "rate"
+
+	// How long we wait for a single mirror by default
+	DefaultProbeTimeout = 5 * time.Second
+	// How many mirrors are probed at the same time by default
+	DefaultProbeThreads = 8
+	// How much of the database we download to measure the rate by default
+	DefaultRateSampleBytes = 2 << 20
+	// How long to wait between the latency samples of a mirror
+	samplePause = 100 * time.Millisecond
+)
+
+// The reason for mirrors that did not answer in time
+var ErrProbeTimeout = errors.New("timeout")
+
+// The mirror answered but does not carry the file of the rate test, e.g.
+// because it leaves out a repository
+var ErrTestFileMissing = errors.New("the test file is missing")
+
+// Parse the name of a ranking mode
+func ParseRankMode(name string) (RankMode, error) {
+	switch mode := RankMode(name); mode {
+	case RankNone, RankLatency, RankRate:
+		return mode, nil
+	}
+
+	return RankNone, fmt.Errorf("unknown ranking mode %q", name)
+}
+
+// How the mirrors are measured
+type RankOptions struct {
+	Mode RankMode
+	// How long to wait for a single mirror
+	Timeout time.Duration
+	// How many mirrors are probed at the same time
+	Threads int
+	// The client used for the probes, http.DefaultClient if nil. The
+	// timeout is applied per probe, so the client should not have one.
+	Client *http.Client
+	// What is downloaded from the mirrors, ArchProbeTarget if empty
+	Target ProbeTarget
+	// Also fetch the lastsync file of every mirror. Mirrors that synced
+	// longer than MaxSyncAge ago fail their probe, the ones without a
+	// usable lastsync file too unless KeepUnknownSync is set.
+	VerifySync      bool
+	MaxSyncAge      time.Duration
+	KeepUnknownSync bool
+	// If both are set, mirrors whose lastupdate file is more than MaxLag
+	// older than MasterUpdate fail their probe
+	MaxLag       time.Duration
+	MasterUpdate time.Time
+	// Send an untimed request for the small file before measuring a mirror,
+	// so that resolving its name and connecting to it is not measured. The
+	// transport of Client has to keep the connection, see
+	// http.Transport.MaxIdleConnsPerHost.
+	Warmup bool
+	// How often the latency of each mirror is measured, 1 if 0. The mirrors
+	// are ranked by the median, each sample has its own Timeout.
+	Samples int
+	// How much of the large file is downloaded from each mirror,
+	// DefaultRateSampleBytes if 0
+	MaxBytes int64
+	// Once the rate probes could download more than this in total, the
+	// remaining mirrors are only measured by latency. 0 for no limit.
+	MaxTotalBytes int64
+	// Called after every probe with the number of finished and failed
+	// probes. The calls are not concurrent.
+	Progress func(done, failed, total int)
+}
+
+// The files that are downloaded from every mirror when ranking
+type ProbeTarget struct {
+	// What $repo and $arch are replaced with
+	Repo string
+	Arch string
+	// A small file for measuring the latency
+	Small string
+	// A file of at least a few MiB for measuring the download rate
+	Large string
+	// Replaces Large with a path below the root of the mirror, like
+	// extra/os/$arch/extra.db. Only $arch is replaced.
+	LargePath string
+}
+
+// The URL of the file of the rate test on the mirror
+func (t ProbeTarget) largeURL(mirror string) string {
+	if t.LargePath != "" {
+		return mirrorRootFile(mirror, strings.ReplaceAll(strings.TrimPrefix(t.LargePath, "/"), "$arch", t.Arch))
+	}
+	return probeURL(mirror, t.Repo, t.Arch, t.Large)
+}
+
+// The files of the Arch Linux mirrors
+var ArchProbeTarget = ProbeTarget{Repo: "core", Arch: "x86_64", Small: "core.db.sig", Large: "core.db"}
+
+// What is downloaded from the mirrors
+func (o *RankOptions) target() ProbeTarget {
+	if o.Target == (ProbeTarget{}) {
+		return ArchProbeTarget
+	}
+	return o.Target
+}
+
+// How much of the large file is downloaded from each mirror
+func (o *RankOptions) sampleBytes() int64 {
+	if o.MaxBytes <= 0 {
+		return DefaultRateSampleBytes
+	}
+	return o.MaxBytes
+}
+
+// What the rate probes may still download. Every probe reserves a whole
+// sample before it starts and gives back what it did not need, so the limit
+// holds with probes running at the same time.
+type byteBudget struct {
+	mu   sync.Mutex
+	left int64
+	// No limit at all
+	unlimited bool
+}
+
+func (b *byteBudget) reserve(n int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.unlimited {
+		return true
+	}
+	if b.left < n {
+		return false
+	}
+	b.left -= n
+	return true
+}
+
+func (b *byteBudget) refund(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.left += n
+}
+
+// The client used for the probes
+func (o *RankOptions) client() *http.Client {
+	if o.Client == nil {
+		return http.DefaultClient
+	}
+	return o.Client
+}
+
+// The measurement of a single mirror
+type ProbeResult struct {
+	Mirror Mirror
+	// How long the probe took
+	Elapsed time.Duration
+	// The number of bytes that were downloaded
+	Bytes int64
+	// Only the latency was measured because the rate probes used up
+	// RankOptions.MaxTotalBytes
+	LatencyOnly bool
+	// The latency samples that succeeded and the range they were in. The
+	// latency of the mirror is their median.
+	Samples                int
+	MinLatency, MaxLatency time.Duration
+	// Every measured request went over a connection that was already open
+	Reused bool
+	// Why the mirror could not be measured
+	Err error
+}
+
+// The outcome of a ranking run
+type RankSummary struct {
+	Mode RankMode
+	// The number of mirrors that were probed
+	Tested int
+	// The number of mirrors that answered
+	Reachable int
+	// The number of mirrors that answered but do not have the test file.
+	// They are kept after the measured mirrors.
+	Missing int
+	// The number of mirrors that were only measured by latency because of
+	// RankOptions.MaxTotalBytes. They come after the ones measured by rate.
+	LatencyOnly int
+	// How much was downloaded from all mirrors
+	Bytes int64
+	// The number of mirrors that were measured over connections that were
+	// already open
+	Reused int
+	// The measurements of all mirrors in the order of the list
+	Results []ProbeResult
+	// The best mirror after sorting
+	Best *Mirror
+}
+
+// The mirrors that could not be reached
+func (s *RankSummary) Failed() []ProbeResult {
+	failed := make([]ProbeResult, 0)
+	for _, r := range s.Results {
+		if r.Err != nil && !errors.Is(r.Err, ErrTestFileMissing) {
+			failed = append(failed, r)
+		}
+	}
+
+	return failed
+}
+
+// The mirrors that do not have the test file
+func (s *RankSummary) MissingTestFile() []ProbeResult {
+	missing := make([]ProbeResult, 0)
+	for _, r := range s.Results {
+		if errors.Is(r.Err, ErrTestFileMissing) {
+			missing = append(missing, r)
+		}
+	}
+
+	return missing
+}
+
+func (s *RankSummary) String() string {
+	if s.Best == nil {
+		return fmt.Sprintf("Tested %d mirrors, none reachable", s.Tested)
+	}
+
+	best := fmt.Sprintf("fastest %d ms", s.Best.Latency.Milliseconds())
+	if s.Mode == RankRate && s.Best.Rate > 0 {
+		best = "fastest " + FormatRate(s.Best.Rate)
+	}
+	if s.Missing > 0 {
+		best += fmt.Sprintf(", %d without the test file", s.Missing)
+	}
+	if s.LatencyOnly > 0 {
+		best += fmt.Sprintf(", %d by latency only", s.LatencyOnly)
+	}
+	if s.Mode == RankRate {
+		best += ", downloaded " + FormatBytes(s.Bytes)
+	}
+	return fmt.Sprintf("Tested %d mirrors, %d reachable, %s", s.Tested, s.Reachable, best)
+}
+
+// Format a rate in bytes per second
+func FormatRate(rate float64) string {
+	switch {
+	case rate >= 1<<20:
+		return fmt.Sprintf("%.2f MiB/s", rate/(1<<20))
+	case rate >= 1<<10:
+		return fmt.Sprintf("%.2f KiB/s", rate/(1<<10))
+	}
+
+	return fmt.Sprintf("%.0f B/s", rate)
+}
+
+// Format a number of bytes
+func FormatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.2f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.2f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.2f KiB", float64(n)/(1<<10))
+	}
+
+	return fmt.Sprintf("%d B", n)
+}
+
+// The units ParseByteSize understands, all of them powers of 1024
+var byteUnits = map[string]int64{
+	"": 1, "b": 1,
+	"k": 1 << 10, "kb": 1 << 10, "kib": 1 << 10,
+	"m": 1 << 20, "mb": 1 << 20, "mib": 1 << 20,
+	"g": 1 << 30, "gb": 1 << 30, "gib": 1 << 30,
+}
+
+// Parse a number of bytes like "512K" or "2MiB"
+func ParseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if i < 0 {
+		i = len(s)
+	}
+	n, err := strconv.ParseInt(s[:i], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a size like 512K or 2M", s)
+	}
+	unit, ok := byteUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit in %q, use K, M or G", s)
+	}
+	if n > math.MaxInt64/unit {
+		return 0, fmt.Errorf("%q is too large", s)
+	}
+
+	return n * unit, nil
+}
+
+// Substitute the pacman variables in a mirror URL and append a file in the
+// resulting directory
+func probeURL(mirror, repo, arch, file string) string {
+	url := strings.NewReplacer("$repo", repo, "$arch", arch).Replace(NormalizeMirrorURL(mirror))
+	return strings.TrimSuffix(url, "/") + "/" + file
+}
+
+// Replace errors caused by the probe deadline with ErrProbeTimeout. If the
+// whole ranking was cancelled or ran out of time instead, the error wraps
+// the reason, which is not the mirror's fault.
+func probeError(ctx context.Context, err error) error {
+	if err := proxyError(err); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		if cause := context.Cause(ctx); cause != ErrProbeTimeout {
+			return fmt.Errorf("probe aborted: %w", cause)
+		}
+		return ErrProbeTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrProbeTimeout
+	}
+
+	return err
+}
+
+// Send a GET request for the file that has to be answered before the
+// timeout. The caller has to call cancel once done with the response.
+func probeGet(ctx context.Context, client *http.Client, url string, timeout time.Duration) (*http.Response, context.Context, context.CancelFunc, error) {
+	// The cause tells our timeout apart from the end of ctx
+	ctx, cancel := context.WithTimeoutCause(ctx, timeout, ErrProbeTimeout)
+	req, err := newRequest(ctx, url)
+	if err != nil {
+		cancel()
+		return nil, nil, nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, nil, nil, probeError(ctx, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, nil, nil, &StatusError{URL: url, Code: resp.StatusCode, Status: resp.Status}
+	}
+
+	return resp, ctx, cancel, nil
+}
+
+// Find out whether the request sent with the returned context gets a
+// connection that was already open
+func traceReuse(ctx context.Context) (context.Context, *bool) {
+	reused := new(bool)
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			*reused = info.Reused
+		},
+	}), reused
+}
+
+// Fetch the small file of the probe target without measuring anything. The
+// body is read to the end, which leaves the connection open for the next
+// request.
+func warmup(ctx context.Context, opts *RankOptions, m *Mirror) error {
+	t := opts.target()
+	resp, _, cancel, err := probeGet(ctx, opts.client(), probeURL(m.URL, t.Repo, t.Arch, t.Small), opts.Timeout)
+	if err != nil {
+		return fmt.Errorf("warm-up: %w", err)
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return fmt.Errorf("warm-up: %w", err)
+	}
+	return nil
+}
+
+// Fetch the small file of the probe target and measure how long it takes
+func probeLatency(ctx context.Context, opts *RankOptions, m *Mirror) ProbeResult {
+	t := opts.target()
+	url := probeURL(m.URL, t.Repo, t.Arch, t.Small)
+
+	ctx, reused := traceReuse(ctx)
+	start := time.Now()
+	resp, ctx, cancel, err := probeGet(ctx, opts.client(), url, opts.Timeout)
+	if err != nil {
+		return ProbeResult{Mirror: *m, Err: err}
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return ProbeResult{Mirror: *m, Err: probeError(ctx, err)}
+	}
+
+	result := ProbeResult{Mirror: *m, Elapsed: time.Since(start), Bytes: n, Reused: *reused}
+	result.Mirror.Latency = result.Elapsed
+	return result
+}
+
+// Measure the latency opts.Samples times and take the median. A mirror
+// that fails more than half of them fails the probe.
+func probeLatencySamples(ctx context.Context, opts *RankOptions, m *Mirror) ProbeResult {
+	n := max(opts.Samples, 1)
+	if n == 1 {
+		return probeLatency(ctx, opts, m)
+	}
+
+	start := time.Now()
+	latencies := make([]time.Duration, 0, n)
+	failed := 0
+	reused := true
+	var bytes int64
+	var lastErr error
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(samplePause):
+			case <-ctx.Done():
+			}
+		}
+		r := probeLatency(ctx, opts, m)
+		bytes += r.Bytes
+		if r.Err != nil {
+			failed++
+			lastErr = r.Err
+			continue
+		}
+		latencies = append(latencies, r.Mirror.Latency)
+		reused = reused && r.Reused
+	}
+	if err := ctx.Err(); err != nil && len(latencies)+failed < n {
+		return ProbeResult{Mirror: *m, Bytes: bytes, Err: err}
+	}
+	if failed*2 > n {
+		return ProbeResult{Mirror: *m, Bytes: bytes, Err: fmt.Errorf("%d of %d samples failed, the last with: %w", failed, n, lastErr)}
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	median := latencies[len(latencies)/2]
+	if len(latencies)%2 == 0 {
+		median = (latencies[len(latencies)/2-1] + median) / 2
+	}
+	result := ProbeResult{
+		Mirror:     *m,
+		Elapsed:    time.Since(start),
+		Bytes:      bytes,
+		Samples:    len(latencies),
+		MinLatency: latencies[0],
+		MaxLatency: latencies[len(latencies)-1],
+		Reused:     reused,
+	}
+	result.Mirror.Latency = median
+	return result
+}
+
+// Download the start of the large file of the probe target and compute the
+// download rate. A mirror that is too slow to deliver the whole sample within
+// the timeout is rated by what it managed to send. The rest of the file is
+// not read, closing the body drops the connection.
+func probeRate(ctx context.Context, opts *RankOptions, m *Mirror) ProbeResult {
+	url := opts.target().largeURL(m.URL)
+
+	ctx, reused := traceReuse(ctx)
+	start := time.Now()
+	resp, ctx, cancel, err := probeGet(ctx, opts.client(), url, opts.Timeout)
+	var status *StatusError
+	if errors.As(err, &status) && status.Code == http.StatusNotFound {
+		return ProbeResult{Mirror: *m, Err: fmt.Errorf("%w: %s", ErrTestFileMissing, url)}
+	} else if err != nil {
+		return ProbeResult{Mirror: *m, Err: err}
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, opts.sampleBytes()))
+	elapsed := time.Since(start)
+	if err != nil && (n == 0 || ctx.Err() == nil) {
+		return ProbeResult{Mirror: *m, Err: probeError(ctx, err)}
+	}
+
+	// What was really read, not the size of the sample or the file
+	result := ProbeResult{Mirror: *m, Elapsed: elapsed, Bytes: n, Reused: *reused}
+	result.Mirror.Rate = float64(n) / elapsed.Seconds()
+	return result
+}
+
+// Measure a single mirror
+func probe(ctx context.Context, opts *RankOptions, budget *byteBudget, m *Mirror) ProbeResult {
+	checked := *m
+	if opts.VerifySync {
+		if err := verifySync(ctx, opts, &checked); err != nil {
+			return ProbeResult{Mirror: checked, Err: err}
+		}
+	}
+	if opts.MaxLag > 0 && !opts.MasterUpdate.IsZero() {
+		if err := verifyLag(ctx, opts, &checked); err != nil {
+			return ProbeResult{Mirror: checked, Err: err}
+		}
+	}
+	m = &checked
+	if opts.Warmup {
+		if err := warmup(ctx, opts, m); err != nil {
+			return ProbeResult{Mirror: *m, Err: err}
+		}
+	}
+
+	switch opts.Mode {
+	case RankLatency:
+		return probeLatencySamples(ctx, opts, m)
+	case RankRate:
+		sample := opts.sampleBytes()
+		if !budget.reserve(sample) {
+			result := probeLatency(ctx, opts, m)
+			result.LatencyOnly = true
+			return result
+		}
+		result := probeRate(ctx, opts, m)
+		budget.refund(sample - result.Bytes)
+		return result
+	}
+
+	return ProbeResult{Mirror: *m, Err: fmt.Errorf("unknown ranking mode %q", opts.Mode)}
+}
+
+// Whether mirror a was measured to be better than mirror b
+func rankedBefore(mode RankMode, a, b *Mirror) bool {
+	switch {
+	case mode == RankRate && a.Rate != b.Rate:
+		return a.Rate > b.Rate
+	case mode == RankLatency && a.Latency != b.Latency:
+		return a.Latency < b.Latency
+	}
+
+	return a.URL < b.URL
+}
+
+// Measure every mirror using a pool of workers and sort them best first.
+// Mirrors that could not be reached are removed from the list. Once ctx is
+// cancelled no new probes are started and the running ones are aborted.
+func Rank(ctx context.Context, l *Mirrorlist, opts RankOptions) *RankSummary {
+	summary := &RankSummary{Mode: opts.Mode, Tested: len(l.Mirrors)}
+	log := loggerFrom(ctx)
+	threads := max(opts.Threads, 1)
+	budget := &byteBudget{left: opts.MaxTotalBytes, unlimited: opts.MaxTotalBytes <= 0}
+
+	type indexedResult struct {
+		index  int
+		result ProbeResult
+	}
+	jobs := make(chan int)
+	results := make(chan indexedResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				results <- indexedResult{index, probe(ctx, &opts, budget, &l.Mirrors[index])}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := range l.Mirrors {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Collect the results in the order of the list, no matter in which order
+	// the probes finish
+	summary.Results = make([]ProbeResult, len(l.Mirrors))
+	probed := make([]bool, len(l.Mirrors))
+	done, failed := 0, 0
+	for r := range results {
+		if r.result.Err != nil {
+			log.Log(ctx, LevelTrace, "Probe failed", "mirror", r.result.Mirror.URL, "error", r.result.Err)
+			failed++
+		} else {
+			log.Log(ctx, LevelTrace, "Probed", "mirror", r.result.Mirror.URL, "duration", r.result.Elapsed.Round(time.Millisecond))
+		}
+		summary.Results[r.index] = r.result
+		summary.Bytes += r.result.Bytes
+		if r.result.Err == nil && r.result.Reused {
+			summary.Reused++
+		}
+		probed[r.index] = true
+		done++
+		if opts.Progress != nil {
+			opts.Progress(done, failed, len(l.Mirrors))
+		}
+	}
+
+	mirrors := make([]Mirror, 0, len(l.Mirrors))
+	// Not having a repository is no reason to drop a mirror, it just cannot
+	// be compared
+	missing := make([]Mirror, 0)
+	// The rate of these is unknown, so they can only be compared with each
+	// other
+	latencyOnly := make([]Mirror, 0)
+	for i, result := range summary.Results {
+		if !probed[i] {
+			summary.Results[i] = ProbeResult{Mirror: l.Mirrors[i], Err: ctx.Err()}
+			continue
+		}
+		if result.Err == nil && result.LatencyOnly {
+			latencyOnly = append(latencyOnly, result.Mirror)
+		} else if result.Err == nil {
+			mirrors = append(mirrors, result.Mirror)
+		} else if errors.Is(result.Err, ErrTestFileMissing) {
+			missing = append(missing, result.Mirror)
+		}
+	}
+
+	sort.SliceStable(mirrors, func(i, j int) bool {
+		return rankedBefore(opts.Mode, &mirrors[i], &mirrors[j])
+	})
+	sort.SliceStable(latencyOnly, func(i, j int) bool {
+		return rankedBefore(RankLatency, &latencyOnly[i], &latencyOnly[j])
+	})
+	mirrors = append(mirrors, latencyOnly...)
+
+	summary.Reachable = len(mirrors)
+	summary.Missing = len(missing)
+	summary.LatencyOnly = len(latencyOnly)
+	if len(mirrors) > 0 {
+		best := mirrors[0]
+		summary.Best = &best
+	}
+	l.Mirrors = append(mirrors, missing...)
+
+	return summary
+}
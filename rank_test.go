@@ -0,0 +1,71 @@
+package archmirror
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A mirror that counts the connections that are opened to it
+func countingMirror(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("signature"))
+	}))
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv, &conns
+}
+
+func TestRankWarmupReusesTheConnection(t *testing.T) {
+	for _, samples := range []int{1, 3} {
+		srv, conns := countingMirror(t)
+		l := testList("Germany", srv.URL+"/$repo/os/$arch")
+
+		summary := Rank(context.Background(), l, RankOptions{
+			Mode:    RankLatency,
+			Timeout: 5 * time.Second,
+			Threads: 1,
+			Client:  srv.Client(),
+			Warmup:  true,
+			Samples: samples,
+		})
+		r := summary.Results[0]
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		if !r.Reused || summary.Reused != 1 {
+			t.Errorf("%d samples: the measured requests did not reuse the warm connection", samples)
+		}
+		if n := conns.Load(); n != 1 {
+			t.Errorf("%d samples: opened %d connections, want 1", samples, n)
+		}
+	}
+}
+
+func TestRankWithoutWarmupMeasuresTheConnect(t *testing.T) {
+	srv, conns := countingMirror(t)
+	l := testList("Germany", srv.URL+"/$repo/os/$arch")
+
+	summary := Rank(context.Background(), l, RankOptions{Mode: RankLatency, Timeout: 5 * time.Second, Threads: 1, Client: srv.Client()})
+	r := summary.Results[0]
+	if r.Err != nil {
+		t.Fatal(r.Err)
+	}
+	if r.Reused || summary.Reused != 0 {
+		t.Error("the only request claims to have reused a connection")
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("opened %d connections, want 1", n)
+	}
+}
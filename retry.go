@@ -0,0 +1,123 @@
+package archmirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// How long to wait before the first retry
+	DefaultRetryDelay = time.Second
+	// The default number of retries after the first attempt
+	DefaultRetries = 3
+)
+
+// An error that may go away when the request is sent again
+type temporaryError struct {
+	err error
+}
+
+func (e *temporaryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *temporaryError) Unwrap() error {
+	return e.err
+}
+
+// The server asked us to slow down
+type RateLimitError struct {
+	URL string
+	// How long the server wants us to wait, 0 if it did not say
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("rate limited by %s, retry after %s", e.URL, e.RetryAfter)
+	}
+	return fmt.Sprintf("rate limited by %s", e.URL)
+}
+
+// Parse a Retry-After header, which is either a number of seconds or an
+// HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	return max(t.Sub(now), 0), true
+}
+
+// The error for a response with status 429
+func rateLimitError(url string, resp *http.Response) error {
+	after, _ := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	return &temporaryError{&RateLimitError{URL: url, RetryAfter: after}}
+}
+
+// Whether sending the request again may help
+func IsTemporary(err error) bool {
+	var temp *temporaryError
+	return errors.As(err, &temp)
+}
+
+// The delay before retry number attempt, doubling each time. The jitter keeps
+// many clients that failed at once from coming back at the same time.
+func backoff(base time.Duration, attempt int) time.Duration {
+	d := base << (attempt - 1)
+	return d/2 + rand.N(d/2+1)
+}
+
+// Call fn until it succeeds, fails with an error that is not temporary or
+// retries retries have been used up. onRetry, if not nil, is called with the
+// number of the failed attempt, its error and the delay before the next one.
+func Retry(ctx context.Context, retries int, onRetry func(attempt int, err error, wait time.Duration), fn func() error) error {
+	attempt := 1
+	for ; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if !IsTemporary(err) || attempt > retries || ctx.Err() != nil {
+			if attempt == 1 {
+				return err
+			}
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		wait := backoff(DefaultRetryDelay, attempt)
+		var limited *RateLimitError
+		if errors.As(err, &limited) && limited.RetryAfter > 0 {
+			wait = limited.RetryAfter
+		}
+		// There is no point in waiting if we are not allowed to try again
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return fmt.Errorf("giving up after %d attempts, the deadline is too close: %w", attempt, err)
+		}
+		if onRetry != nil {
+			onRetry(attempt, err, wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("giving up after %d attempts: %w (last error: %v)", attempt, ctx.Err(), err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package archmirror
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A generator that is rate limiting the first limited requests
+func rateLimitedGenerator(t *testing.T, limited int32, retryAfter string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= limited {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(testMirrorlist))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestRetryAfterRateLimit(t *testing.T) {
+	srv, requests := rateLimitedGenerator(t, 1, "1")
+	ctx := context.Background()
+
+	var list *Mirrorlist
+	var waits []time.Duration
+	err := Retry(ctx, DefaultRetries, func(attempt int, err error, wait time.Duration) {
+		var limited *RateLimitError
+		if !errors.As(err, &limited) {
+			t.Errorf("attempt %d failed with %v, want a *RateLimitError", attempt, err)
+		}
+		waits = append(waits, wait)
+	}, func() error {
+		var err error
+		list, err = RequestMirrorListContext(ctx, srv.Client(), testConfig(srv))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Mirrors) != 2 {
+		t.Errorf("got %d mirrors, want 2", len(list.Mirrors))
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("sent %d requests, want 2", n)
+	}
+	if len(waits) != 1 || waits[0] != time.Second {
+		t.Errorf("waited %v, want the second of the Retry-After header", waits)
+	}
+}
+
+func TestRetryAfterIsCancellable(t *testing.T) {
+	srv, requests := rateLimitedGenerator(t, 1, "3600")
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := Retry(ctx, DefaultRetries, nil, func() error {
+		_, err := RequestMirrorListContext(ctx, srv.Client(), testConfig(srv))
+		return err
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("cancelling took %s", elapsed)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+}
+
+func TestRetryAfterDeadlineTooClose(t *testing.T) {
+	srv, _ := rateLimitedGenerator(t, 1, "3600")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := Retry(ctx, DefaultRetries, nil, func() error {
+		_, err := RequestMirrorListContext(ctx, srv.Client(), testConfig(srv))
+		return err
+	})
+	var limited *RateLimitError
+	if !errors.As(err, &limited) || limited.RetryAfter != time.Hour {
+		t.Errorf("got %v, want to give up on a rate limit of an hour", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{" 0 ", 0, true},
+		{"Wed, 14 Oct 2026 12:00:30 GMT", 30 * time.Second, true},
+		// Already over
+		{"Wed, 14 Oct 2026 11:00:00 GMT", 0, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"", 0, false},
+	} {
+		got, ok := parseRetryAfter(tc.value, now)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("parseRetryAfter(%q) = %s, %t, want %s, %t", tc.value, got, ok, tc.want, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package archmirror
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Something the mirrors can be sorted by
+type SortKey string
+
+const (
+	// Fastest download rate first, needs RankRate
+	SortRate SortKey = "rate"
+	// Lowest latency first, needs RankLatency
+	SortLatency SortKey = "latency"
+	// Best archlinux.org score first, needs the mirror status
+	SortScore SortKey = "score"
+	// Most recently synced first, needs the mirror status unless the
+	// lastsync files were checked
+	SortAge SortKey = "age"
+	// Least behind first, needs the mirror status
+	SortDelay SortKey = "delay"
+	// By the name of the country section
+	SortCountry SortKey = "country"
+	// In a random order
+	SortRandom SortKey = "random"
+)
+
+// The keys ParseSortKeys accepts
+var SortKeys = []SortKey{SortRate, SortLatency, SortScore, SortAge, SortDelay, SortCountry, SortRandom}
+
+// Parse a comma-separated list of sort keys like "country,rate"
+func ParseSortKeys(s string) ([]SortKey, error) {
+	keys := make([]SortKey, 0)
+	for _, name := range strings.Split(s, ",") {
+		key := SortKey(strings.ToLower(strings.TrimSpace(name)))
+		if key == "" {
+			continue
+		}
+		known := false
+		for _, k := range SortKeys {
+			known = known || k == key
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown sort key %q", name)
+		}
+		for _, k := range keys {
+			if k == key {
+				return nil, fmt.Errorf("sort key %q is given twice", name)
+			}
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// Whether the key sorts by something from the archlinux.org mirror status
+func (k SortKey) NeedsStatus() bool {
+	return k == SortScore || k == SortAge || k == SortDelay
+}
+
+// The ranking mode that measures what the key sorts by, RankNone if it needs
+// no measurement
+func (k SortKey) RankMode() RankMode {
+	switch k {
+	case SortRate:
+		return RankRate
+	case SortLatency:
+		return RankLatency
+	}
+
+	return RankNone
+}
+
+// Compare a and b by key. Returns a negative number if a comes first, a
+// positive one if b does and 0 if they are equal. Mirrors that lack what the
+// key sorts by come last.
+func compareBy(key SortKey, a, b *Mirror, random map[string]float64) int {
+	// Mirrors that have the value come first, then the better value
+	compare := func(aOK, bOK bool, aFirst, bFirst bool) int {
+		switch {
+		case aOK != bOK && aOK:
+			return -1
+		case aOK != bOK:
+			return 1
+		case !aOK:
+			return 0
+		case aFirst:
+			return -1
+		case bFirst:
+			return 1
+		}
+		return 0
+	}
+
+	switch key {
+	case SortRate:
+		return compare(a.Rate > 0, b.Rate > 0, a.Rate > b.Rate, a.Rate < b.Rate)
+	case SortLatency:
+		return compare(a.Latency > 0, b.Latency > 0, a.Latency < b.Latency, a.Latency > b.Latency)
+	case SortScore:
+		aOK, bOK := a.Status != nil && a.Status.Score != nil, b.Status != nil && b.Status.Score != nil
+		if !aOK || !bOK {
+			return compare(aOK, bOK, false, false)
+		}
+		return compare(true, true, *a.Status.Score < *b.Status.Score, *a.Status.Score > *b.Status.Score)
+	case SortAge:
+		aSync, bSync := a.synced(), b.synced()
+		return compare(!aSync.IsZero(), !bSync.IsZero(), aSync.After(bSync), aSync.Before(bSync))
+	case SortDelay:
+		aOK, bOK := a.Status != nil && a.Status.Delay != nil, b.Status != nil && b.Status.Delay != nil
+		if !aOK || !bOK {
+			return compare(aOK, bOK, false, false)
+		}
+		return compare(true, true, *a.Status.Delay < *b.Status.Delay, *a.Status.Delay > *b.Status.Delay)
+	case SortCountry:
+		// Mirrors outside of any country section, e.g. the ones added by
+		// hand, have none
+		aOK, bOK := a.Country != "", b.Country != ""
+		if !aOK || !bOK {
+			return compare(aOK, bOK, false, false)
+		}
+		return strings.Compare(a.Country, b.Country)
+	case SortRandom:
+		return compare(true, true, random[a.URL] < random[b.URL], random[a.URL] > random[b.URL])
+	}
+
+	return 0
+}
+
+// When the mirror last synced, from its lastsync file or the mirror status.
+// Zero if unknown.
+func (m *Mirror) synced() time.Time {
+	if !m.LastSync.IsZero() {
+		return m.LastSync
+	}
+	if m.Status != nil && m.Status.LastSync != nil {
+		return *m.Status.LastSync
+	}
+	return time.Time{}
+}
+
+// Sort the mirrors by the keys, each one deciding between the mirrors that
+// are equal by the ones before, and by URL at last
+func SortMirrors(l *Mirrorlist, keys []SortKey) {
+	random := make(map[string]float64)
+	for _, k := range keys {
+		if k == SortRandom {
+			for _, m := range l.Mirrors {
+				random[m.URL] = rand.Float64()
+			}
+		}
+	}
+
+	sort.SliceStable(l.Mirrors, func(i, j int) bool {
+		a, b := &l.Mirrors[i], &l.Mirrors[j]
+		for _, k := range keys {
+			if c := compareBy(k, a, b, random); c != 0 {
+				return c < 0
+			}
+		}
+		return a.URL < b.URL
+	})
+}
@@ -0,0 +1,60 @@
+package archmirror
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSortCountryUnknownLast(t *testing.T) {
+	l := &Mirrorlist{Mirrors: []Mirror{
+		{URL: "https://a.example/$repo/os/$arch"},
+		{URL: "https://b.example/$repo/os/$arch", Country: "Sweden"},
+		{URL: "https://c.example/$repo/os/$arch", Country: "Germany"},
+		{URL: "https://d.example/$repo/os/$arch"},
+		{URL: "https://e.example/$repo/os/$arch", Country: "Austria"},
+	}}
+
+	SortMirrors(l, []SortKey{SortCountry})
+	want := []string{
+		"https://e.example/$repo/os/$arch",
+		"https://c.example/$repo/os/$arch",
+		"https://b.example/$repo/os/$arch",
+		"https://a.example/$repo/os/$arch",
+		"https://d.example/$repo/os/$arch",
+	}
+	got := make([]string, 0, len(l.Mirrors))
+	for _, m := range l.Mirrors {
+		got = append(got, m.URL)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSortMirrorsKeys(t *testing.T) {
+	l := &Mirrorlist{Mirrors: []Mirror{
+		{URL: "https://a.example/$repo/os/$arch", Country: "Germany", Latency: 30 * time.Millisecond},
+		{URL: "https://b.example/$repo/os/$arch", Country: "France", Latency: 20 * time.Millisecond},
+		{URL: "https://c.example/$repo/os/$arch", Country: "Germany", Latency: 10 * time.Millisecond},
+		{URL: "https://d.example/$repo/os/$arch", Country: "Germany"},
+		{URL: "https://e.example/$repo/os/$arch", Latency: 5 * time.Millisecond},
+	}}
+
+	SortMirrors(l, []SortKey{SortCountry, SortLatency})
+	want := []string{
+		"https://b.example/$repo/os/$arch",
+		"https://c.example/$repo/os/$arch",
+		"https://a.example/$repo/os/$arch",
+		// Not measured
+		"https://d.example/$repo/os/$arch",
+		"https://e.example/$repo/os/$arch",
+	}
+	got := make([]string, 0, len(l.Mirrors))
+	for _, m := range l.Mirrors {
+		got = append(got, m.URL)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,196 @@
+package archmirror
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Where archlinux.org publishes the results of its mirror checks
+	MirrorStatusUrl string = "https://archlinux.org/mirrors/status/json/"
+	// The version of the status format that we understand
+	mirrorStatusVersion = 3
+)
+
+// The status of a single mirror URL as reported by archlinux.org
+type MirrorStatus struct {
+	URL      string `json:"url"`
+	Protocol string `json:"protocol"`
+	// When the mirror last synced, nil if it never did
+	LastSync *time.Time `json:"last_sync"`
+	// The fraction of the checks that the mirror passed
+	CompletionPct float64 `json:"completion_pct"`
+	// How many seconds the mirror is behind, nil if unknown
+	Delay *int64 `json:"delay"`
+	// The average time in seconds it took to fetch from the mirror
+	DurationAvg    *float64 `json:"duration_avg"`
+	DurationStddev *float64 `json:"duration_stddev"`
+	// The mirror score, lower is better. nil if unknown.
+	Score       *float64 `json:"score"`
+	Active      bool     `json:"active"`
+	Country     string   `json:"country"`
+	CountryCode string   `json:"country_code"`
+	ISOs        bool     `json:"isos"`
+	IPv4        bool     `json:"ipv4"`
+	IPv6        bool     `json:"ipv6"`
+	// The page with details about the mirror
+	Details string `json:"details"`
+}
+
+// The results of the archlinux.org mirror checks
+type StatusReport struct {
+	Cutoff         int            `json:"cutoff"`
+	LastCheck      time.Time      `json:"last_check"`
+	NumChecks      int            `json:"num_checks"`
+	CheckFrequency int            `json:"check_frequency"`
+	URLs           []MirrorStatus `json:"urls"`
+	Version        int            `json:"version"`
+}
+
+// Fetch the mirror status from archlinux.org
+func RequestMirrorStatus() (*StatusReport, error) {
+	return RequestMirrorStatusContext(context.Background(), http.DefaultClient)
+}
+
+// Fetch the mirror status from archlinux.org using client until ctx is done
+func RequestMirrorStatusContext(ctx context.Context, client *http.Client) (*StatusReport, error) {
+	return RequestMirrorStatusFrom(ctx, client, MirrorStatusUrl)
+}
+
+// Fetch the mirror status from url instead of archlinux.org
+func RequestMirrorStatusFrom(ctx context.Context, client *http.Client, url string) (*StatusReport, error) {
+	req, err := newRequest(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	loggerFrom(ctx).Debug("Requesting the mirror status", "url", url)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, requestError(ctx, "requesting", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	if err := checkContentType(resp.Header.Get("Content-Type"), "application/json"); err != nil {
+		return nil, fmt.Errorf("requesting %s: %w", finalURL(url, resp), err)
+	}
+
+	report := &StatusReport{}
+	if err := json.NewDecoder(resp.Body).Decode(report); err != nil {
+		if ctx.Err() != nil {
+			return nil, requestError(ctx, "reading the mirror status from", url, err)
+		}
+		return nil, fmt.Errorf("unexpected mirror status format from %s: %w", url, err)
+	}
+	if report.Version != mirrorStatusVersion {
+		return nil, fmt.Errorf("unexpected mirror status format from %s: version %d instead of %d", url, report.Version, mirrorStatusVersion)
+	}
+	if report.URLs == nil {
+		return nil, fmt.Errorf("unexpected mirror status format from %s: no urls", url)
+	}
+
+	return report, nil
+}
+
+// The URL of the mirror without the pacman variables, as used by the
+// status report
+func mirrorBaseURL(url string) string {
+	url = strings.TrimSuffix(NormalizeMirrorURL(url), "$repo/os/$arch")
+	return strings.TrimSuffix(url, "/") + "/"
+}
+
+// Attach the status of each mirror to the mirrors of the list. Returns the
+// number of mirrors that were found in the report.
+func (r *StatusReport) Attach(l *Mirrorlist) int {
+	byURL := make(map[string]*MirrorStatus, len(r.URLs))
+	for i := range r.URLs {
+		byURL[mirrorBaseURL(r.URLs[i].URL)] = &r.URLs[i]
+	}
+
+	found := 0
+	for i := range l.Mirrors {
+		if status, ok := byURL[mirrorBaseURL(l.Mirrors[i].URL)]; ok {
+			l.Mirrors[i].Status = status
+			found++
+		}
+	}
+
+	return found
+}
+
+// The active rsync mirrors in the countries and with the IP versions of the
+// configuration
+func (r *StatusReport) RsyncMirrors(c *MirrorListConfig) ([]Mirror, error) {
+	countries := make(map[string]bool)
+	for _, v := range c.Countries {
+		code, err := ResolveCountry(v)
+		if err != nil {
+			return nil, err
+		}
+		countries[code] = true
+	}
+
+	mirrors := make([]Mirror, 0)
+	for i := range r.URLs {
+		s := &r.URLs[i]
+		if s.Protocol != "rsync" || !s.Active {
+			continue
+		}
+		if !countries[CountryAll] && !countries[strings.ToUpper(s.CountryCode)] {
+			continue
+		}
+
+		ipVersion := false
+		for _, v := range c.IPVersions {
+			ipVersion = ipVersion || (v == IPVersion4 && s.IPv4) || (v == IPVersion6 && s.IPv6)
+		}
+		if !ipVersion {
+			continue
+		}
+
+		mirrors = append(mirrors, Mirror{
+			URL:      NormalizeMirrorURL(s.URL),
+			Protocol: ProtocolTypeRsync,
+			Country:  s.Country,
+			Active:   true,
+			Status:   s,
+		})
+	}
+
+	return mirrors, nil
+}
+
+// Sort the mirrors by their score, best first. Mirrors without a score are
+// moved to the end or removed if drop is set. Returns the number of
+// removed mirrors.
+func SortByScore(l *Mirrorlist, drop bool) int {
+	mirrors := make([]Mirror, 0, len(l.Mirrors))
+	for _, m := range l.Mirrors {
+		if drop && (m.Status == nil || m.Status.Score == nil) {
+			continue
+		}
+		mirrors = append(mirrors, m)
+	}
+
+	sort.SliceStable(mirrors, func(i, j int) bool {
+		a, b := mirrors[i].Status, mirrors[j].Status
+		switch {
+		case b == nil || b.Score == nil:
+			return a != nil && a.Score != nil
+		case a == nil || a.Score == nil:
+			return false
+		}
+		return *a.Score < *b.Score
+	})
+
+	dropped := len(l.Mirrors) - len(mirrors)
+	l.Mirrors = mirrors
+	return dropped
+}
@@ -0,0 +1,75 @@
+package archmirror
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const testStatus = `{
+  "cutoff": 86400,
+  "last_check": "2026-10-14T12:00:00Z",
+  "num_checks": 24,
+  "check_frequency": 3600,
+  "version": 3,
+  "urls": [
+    {
+      "url": "https://a.example/",
+      "protocol": "https",
+      "last_sync": "2026-10-14T11:00:00Z",
+      "completion_pct": 1.0,
+      "delay": 3600,
+      "score": 1.5,
+      "active": true,
+      "country": "Germany",
+      "country_code": "DE",
+      "ipv4": true,
+      "details": "https://archlinux.org/mirrors/a.example/1/"
+    }
+  ]
+}`
+
+func TestRequestMirrorStatusFrom(t *testing.T) {
+	srv := testGenerator(t, http.StatusOK, "application/json", testStatus)
+
+	report, err := RequestMirrorStatusFrom(context.Background(), srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.URLs) != 1 || report.URLs[0].URL != "https://a.example/" {
+		t.Errorf("got %v, want the mirror of the report", report.URLs)
+	}
+}
+
+func TestRequestMirrorStatusErrors(t *testing.T) {
+	html := testGenerator(t, http.StatusOK, "text/html", "<html>Maintenance</html>")
+	_, err := RequestMirrorStatusFrom(context.Background(), html.Client(), html.URL)
+	if !errors.Is(err, ErrNotJSON) {
+		t.Errorf("got %v for an HTML page, want %v", err, ErrNotJSON)
+	}
+
+	missing := testGenerator(t, http.StatusNotFound, "text/plain", "not found")
+	_, err = RequestMirrorStatusFrom(context.Background(), missing.Client(), missing.URL)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusNotFound {
+		t.Errorf("got %v, want a *StatusError with 404", err)
+	}
+
+	slow := slowMirror(t, 5*time.Second)
+	// A copy, the client of the server is shared
+	client := *slow.Client()
+	client.Timeout = 50 * time.Millisecond
+	_, err = RequestMirrorStatusFrom(context.Background(), &client, slow.URL)
+	if !errors.Is(err, ErrRequestTimeout) {
+		t.Errorf("got %v from a client that timed out, want %v", err, ErrRequestTimeout)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = RequestMirrorStatusFrom(ctx, slow.Client(), slow.URL)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v after cancelling, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,134 @@
+package archmirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// How long ago a mirror may have synced with -verify-sync by default
+	DefaultMaxSyncAge = 6 * time.Hour
+	// When the repositories of the master mirror last changed
+	MasterLastUpdateURL = "https://repos.archlinux.org/lastupdate"
+	// A timestamp is not even a dozen bytes
+	timestampBytes = 64
+)
+
+var (
+	// A mirror synced longer ago than allowed
+	ErrOutOfSync = errors.New("out of sync")
+	// A mirror has no lastsync file or it does not contain a timestamp
+	ErrSyncUnknown = errors.New("unknown sync time")
+)
+
+// The lastsync and lastupdate files are at the root of the mirror, in front
+// of the first pacman variable
+func mirrorRootFile(mirror, file string) string {
+	url := NormalizeMirrorURL(mirror)
+	if i := strings.Index(url, "$"); i >= 0 {
+		url = url[:i]
+	}
+
+	return strings.TrimSuffix(url, "/") + "/" + file
+}
+
+// Parse the Unix timestamp in a lastsync or lastupdate file
+func parseTimestamp(r io.Reader) (time.Time, error) {
+	data, err := io.ReadAll(io.LimitReader(r, timestampBytes))
+	if err != nil {
+		return time.Time{}, err
+	}
+	seconds, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}, ErrSyncUnknown
+	}
+
+	return time.Unix(seconds, 0), nil
+}
+
+// Fetch the time in the lastupdate file of the master mirror using client
+func RequestMasterLastUpdate(ctx context.Context, client *http.Client, url string) (time.Time, error) {
+	req, err := newRequest(ctx, url)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return time.Time{}, requestError(ctx, "requesting", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, statusError(resp)
+	}
+
+	updated, err := parseTimestamp(resp.Body)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("reading %s: %w", url, err)
+	}
+	return updated, nil
+}
+
+// Fetch a file of the mirror that contains a Unix timestamp
+func probeTimestamp(ctx context.Context, opts *RankOptions, m *Mirror, file string) (time.Time, error) {
+	url := mirrorRootFile(m.URL, file)
+	resp, ctx, cancel, err := probeGet(ctx, opts.client(), url, opts.Timeout)
+	var status *StatusError
+	if errors.As(err, &status) && status.Code == http.StatusNotFound {
+		return time.Time{}, fmt.Errorf("%w: %s is missing", ErrSyncUnknown, url)
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	t, err := parseTimestamp(resp.Body)
+	if errors.Is(err, ErrSyncUnknown) {
+		return time.Time{}, fmt.Errorf("%w: %s does not contain a timestamp", ErrSyncUnknown, url)
+	} else if err != nil {
+		return time.Time{}, probeError(ctx, err)
+	}
+
+	return t, nil
+}
+
+// Check the lastsync file of the mirror and record the time in it. Returns
+// why the mirror must not be used.
+func verifySync(ctx context.Context, opts *RankOptions, m *Mirror) error {
+	synced, err := probeTimestamp(ctx, opts, m, "lastsync")
+	if errors.Is(err, ErrSyncUnknown) && opts.KeepUnknownSync {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	m.LastSync = synced
+
+	if age := time.Since(synced); opts.MaxSyncAge > 0 && age > opts.MaxSyncAge {
+		return fmt.Errorf("%w, last synced %s ago", ErrOutOfSync, age.Round(time.Minute))
+	}
+	return nil
+}
+
+// Compare the lastupdate file of the mirror with the one of the master mirror
+// and record the lag. Returns why the mirror must not be used.
+func verifyLag(ctx context.Context, opts *RankOptions, m *Mirror) error {
+	updated, err := probeTimestamp(ctx, opts, m, "lastupdate")
+	if errors.Is(err, ErrSyncUnknown) && opts.KeepUnknownSync {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// A mirror may have synced after we asked the master
+	lag := max(opts.MasterUpdate.Sub(updated), 0)
+	m.Lag = &lag
+
+	if lag > opts.MaxLag {
+		return fmt.Errorf("%w, %s behind the master mirror", ErrOutOfSync, lag.Round(time.Minute))
+	}
+	return nil
+}
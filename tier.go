@@ -0,0 +1,147 @@
+package archmirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Looks up the tier of mirrors using the archlinux.org mirror details and
+// remembers the answers
+type TierResolver struct {
+	// Lookups are aborted once the context is done
+	ctx    context.Context
+	client *http.Client
+	// The tier of each mirror by the URL of its JSON details
+	cache map[string]tierLookup
+}
+
+type tierLookup struct {
+	tier int
+	err  error
+}
+
+// Create a resolver with an empty cache
+func NewTierResolver() *TierResolver {
+	return NewTierResolverContext(context.Background(), http.DefaultClient)
+}
+
+// Create a resolver with an empty cache whose lookups use client and are
+// bound to ctx
+func NewTierResolverContext(ctx context.Context, client *http.Client) *TierResolver {
+	return &TierResolver{ctx: ctx, client: client, cache: make(map[string]tierLookup)}
+}
+
+// The URL of the JSON details of the mirror that a status details page,
+// e.g. https://archlinux.org/mirrors/example.org/1234/, belongs to
+func mirrorDetailsJSONURL(details string) (string, error) {
+	parts := strings.Split(strings.Trim(details, "/"), "/")
+	for i, part := range parts {
+		if part == "mirrors" && i+1 < len(parts) {
+			return strings.Join(parts[:i+2], "/") + "/json/", nil
+		}
+	}
+
+	return "", fmt.Errorf("unexpected mirror details URL %q", details)
+}
+
+// Parse the tier, which is either a number or something like "Tier 1"
+func parseTier(raw json.RawMessage) (int, error) {
+	var n int
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, fmt.Errorf("unexpected tier %s", raw)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(s, "Tier")))
+	if err != nil {
+		return 0, fmt.Errorf("unexpected tier %q", s)
+	}
+
+	return n, nil
+}
+
+// Find the tier of the mirror that the status belongs to
+func (r *TierResolver) Tier(status *MirrorStatus) (int, error) {
+	if status == nil || status.Details == "" {
+		return 0, errors.New("no mirror details")
+	}
+	// Every URL of a mirror has its own details page, but they all belong
+	// to the same mirror
+	url, err := mirrorDetailsJSONURL(status.Details)
+	if err != nil {
+		return 0, err
+	}
+	lookup, ok := r.cache[url]
+	if !ok {
+		lookup.tier, lookup.err = requestTier(r.ctx, r.client, url)
+		r.cache[url] = lookup
+	}
+
+	return lookup.tier, lookup.err
+}
+
+// Fetch the tier from the JSON details of a mirror at url
+func requestTier(ctx context.Context, client *http.Client, url string) (int, error) {
+	req, err := newRequest(ctx, url)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, requestError(ctx, "requesting", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, statusError(resp)
+	}
+	if err := checkContentType(resp.Header.Get("Content-Type"), "application/json"); err != nil {
+		return 0, fmt.Errorf("requesting %s: %w", finalURL(url, resp), err)
+	}
+
+	var details struct {
+		Tier json.RawMessage `json:"tier"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&details); err != nil {
+		if ctx.Err() != nil {
+			return 0, requestError(ctx, "reading the mirror details from", url, err)
+		}
+		return 0, fmt.Errorf("unexpected mirror details format from %s: %w", url, err)
+	}
+	if details.Tier == nil {
+		return 0, fmt.Errorf("unexpected mirror details format from %s: no tier", url)
+	}
+
+	tier, err := parseTier(details.Tier)
+	if err != nil {
+		return 0, fmt.Errorf("reading the tier from %s: %w", url, err)
+	}
+
+	return tier, nil
+}
+
+// Only keep mirrors of the given tier. Mirrors whose tier cannot be found
+// out are removed.
+func TierFilter(tier int, resolver *TierResolver) Filter {
+	return Filter{
+		Description: fmt.Sprintf("tier == %d", tier),
+		Keep: func(m *Mirror) bool {
+			t, err := resolver.Tier(m.Status)
+			return err == nil && t == tier
+		},
+		Detail: func(m *Mirror) string {
+			t, err := resolver.Tier(m.Status)
+			if err != nil {
+				return "unknown tier: " + err.Error()
+			}
+			return fmt.Sprintf("tier %d", t)
+		},
+	}
+}
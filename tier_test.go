@@ -0,0 +1,90 @@
+package archmirror
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMirrorDetailsJSONURL(t *testing.T) {
+	for details, want := range map[string]string{
+		"https://archlinux.org/mirrors/a.example/1234/": "https://archlinux.org/mirrors/a.example/json/",
+		"https://archlinux.org/mirrors/a.example/":      "https://archlinux.org/mirrors/a.example/json/",
+		"https://archlinux.org/mirrors/a.example":       "https://archlinux.org/mirrors/a.example/json/",
+	} {
+		got, err := mirrorDetailsJSONURL(details)
+		if err != nil || got != want {
+			t.Errorf("mirrorDetailsJSONURL(%q) = %q, %v, want %q", details, got, err, want)
+		}
+	}
+	if got, err := mirrorDetailsJSONURL("https://archlinux.org/packages/"); err == nil {
+		t.Errorf("got %q for a page that is not about a mirror", got)
+	}
+}
+
+// The URLs of a mirror share the lookup even though their details pages
+// differ
+func TestTierResolverCachesByMirror(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/mirrors/a.example/json/" {
+			w.Write([]byte(`{"tier": "Tier 1"}`))
+		} else {
+			w.Write([]byte(`{"tier": 2}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	r := NewTierResolverContext(context.Background(), srv.Client())
+
+	for _, tc := range []struct {
+		details string
+		want    int
+	}{
+		{srv.URL + "/mirrors/a.example/1/", 1},
+		{srv.URL + "/mirrors/a.example/2/", 1},
+		{srv.URL + "/mirrors/b.example/3/", 2},
+		{srv.URL + "/mirrors/a.example/1/", 1},
+	} {
+		tier, err := r.Tier(&MirrorStatus{Details: tc.details})
+		if err != nil || tier != tc.want {
+			t.Errorf("%s: got tier %d, %v, want %d", tc.details, tier, err, tc.want)
+		}
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("sent %d requests for two mirrors", n)
+	}
+
+	if _, err := r.Tier(&MirrorStatus{}); err == nil {
+		t.Error("got a tier for a mirror without details")
+	}
+}
+
+func TestRequestTierErrors(t *testing.T) {
+	html := testGenerator(t, http.StatusOK, "text/html", "<html>Maintenance</html>")
+	_, err := requestTier(context.Background(), html.Client(), html.URL+"/mirrors/a.example/json/")
+	if !errors.Is(err, ErrNotJSON) {
+		t.Errorf("got %v for an HTML page, want %v", err, ErrNotJSON)
+	}
+
+	slow := slowMirror(t, 5*time.Second)
+	// A copy, the client of the server is shared
+	client := *slow.Client()
+	client.Timeout = 50 * time.Millisecond
+	_, err = requestTier(context.Background(), &client, slow.URL+"/mirrors/a.example/json/")
+	if !errors.Is(err, ErrRequestTimeout) {
+		t.Errorf("got %v from a client that timed out, want %v", err, ErrRequestTimeout)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = requestTier(ctx, slow.Client(), slow.URL+"/mirrors/a.example/json/")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v after cancelling, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,81 @@
+package archmirror
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// An active Server line that pacman would not be able to use
+type ServerLineError struct {
+	// The number of the line, starting at 1
+	Line int
+	URL  string
+	// The line is inside a keep block, so it came from the old mirrorlist
+	Kept   bool
+	Reason string
+}
+
+func (e *ServerLineError) Error() string {
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.URL, e.Reason)
+}
+
+// Check that the URL of a Server line is one pacman can use
+func checkServerURL(raw, suffix string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "not a URL"
+	}
+	switch u.Scheme {
+	case "http", "https", "ftp", "rsync":
+		if u.Host == "" {
+			return "the URL has no host"
+		}
+	case "file":
+	case "":
+		return "the URL has no scheme"
+	default:
+		return fmt.Sprintf("pacman does not download over %s", u.Scheme)
+	}
+	if !strings.HasSuffix(raw, suffix) {
+		return fmt.Sprintf("does not end with %s", suffix)
+	}
+
+	return ""
+}
+
+// Check every active Server line of a mirrorlist in the pacman format.
+// Commented out lines are left alone, pacman ignores them. Every Server line
+// has to end with suffix, see Flavor.ServerSuffix.
+func ValidateMirrorlist(r io.Reader, suffix string) ([]*ServerLineError, error) {
+	errs := make([]*ServerLineError, 0)
+	// A BOM would hide the first line from parseServerLine
+	scanner := bufio.NewScanner(skipBOM(r))
+	keeping := false
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		switch strings.TrimSpace(line) {
+		case KeepMarker:
+			keeping = true
+			continue
+		case KeepEndMarker:
+			keeping = false
+			continue
+		}
+
+		url, commented, ok := parseServerLine(line)
+		if !ok || commented {
+			continue
+		}
+		if reason := checkServerURL(url, suffix); reason != "" {
+			errs = append(errs, &ServerLineError{Line: n, URL: url, Kept: keeping, Reason: reason})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading mirrorlist: %w", err)
+	}
+
+	return errs, nil
+}
@@ -0,0 +1,55 @@
+package archmirror
+
+import (
+	"strings"
+	"testing"
+)
+
+const serverSuffix = "/$repo/os/$arch"
+
+func TestValidateMirrorlist(t *testing.T) {
+	list := "## Germany\n" +
+		"Server = https://a.example/$repo/os/$arch\n" +
+		"#Server = https://b.example/archlinux/\n" +
+		"Server = https://c.example/archlinux/\n" +
+		"Server = gopher://d.example/$repo/os/$arch\n" +
+		KeepMarker + "\n" +
+		"Server = https:///$repo/os/$arch\n" +
+		KeepEndMarker + "\n" +
+		"Server = file:///srv/mirror/$repo/os/$arch\n"
+
+	errs, err := ValidateMirrorlist(strings.NewReader(list), serverSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ServerLineError{
+		{Line: 4, URL: "https://c.example/archlinux/"},
+		{Line: 5, URL: "gopher://d.example/$repo/os/$arch"},
+		{Line: 7, URL: "https:///$repo/os/$arch", Kept: true},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("got %v, want %d errors", errs, len(want))
+	}
+	for i, e := range errs {
+		if e.Line != want[i].Line || e.URL != want[i].URL || e.Kept != want[i].Kept {
+			t.Errorf("got %+v, want %+v", *e, want[i])
+		}
+	}
+}
+
+// The first line must be checked too, even behind a BOM or with CRLF
+func TestValidateMirrorlistBOM(t *testing.T) {
+	for _, list := range []string{
+		"\ufeffServer = https://a.example/archlinux/\n",
+		"\ufeffServer = https://a.example/archlinux/\r\nServer = https://b.example/$repo/os/$arch\r\n",
+		readFixture(t, "crlf.mirrorlist") + "Server = https://a.example/archlinux/\n",
+	} {
+		errs, err := ValidateMirrorlist(strings.NewReader(list), serverSuffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(errs) != 1 || errs[0].URL != "https://a.example/archlinux/" {
+			t.Errorf("got %v for %q, want the URL without the placeholders", errs, list)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package archmirror
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// The mode of newly created mirrorlists
+const defaultFileMode fs.FileMode = 0600
+
+// Write data to path by writing a temporary file in the same directory and
+// moving it into place, so that the target is either left untouched or
+// completely replaced. An existing target is only replaced if overwrite is
+// set, in which case its file mode is kept.
+func WriteFileAtomic(path string, data []byte, overwrite bool) error {
+	mode := defaultFileMode
+	info, err := os.Stat(path)
+	switch {
+	case err == nil:
+		if !overwrite {
+			return &fs.PathError{Op: "write", Path: path, Err: fs.ErrExist}
+		}
+		mode = info.Mode().Perm()
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	// The temporary file has to be in the same directory so that the rename
+	// does not cross filesystems
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	// Once the file has been moved into place this is a no-op
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if overwrite {
+		err = os.Rename(tmpName, path)
+	} else {
+		// Unlike a rename, linking fails if the target was created in the
+		// meantime
+		err = os.Link(tmpName, path)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Make sure that the rename itself survives a crash
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
+
+// Check whether WriteFileAtomic could write path, without touching an
+// existing file. This is only a hint to fail early, the file may still become
+// unwritable before it is written.
+func CheckWritable(path string) error {
+	dir := filepath.Dir(path)
+	info, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("missing directory %s: %w", dir, fs.ErrNotExist)
+	} else if err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	// Opening without O_TRUNC leaves the content alone
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	switch {
+	case err == nil:
+		file.Close()
+	case errors.Is(err, fs.ErrPermission):
+		return fmt.Errorf("the file %s is not writable: %w", path, fs.ErrPermission)
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	// The new file is created next to the old one and moved into place
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".check-*")
+	if errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("cannot create files in %s: %w", dir, fs.ErrPermission)
+	} else if err != nil {
+		return err
+	}
+	tmp.Close()
+	os.Remove(tmp.Name())
+
+	return nil
+}